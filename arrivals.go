@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// arrivals is the arrival process of the sends of a run. Every ordered pair
+// of chains sends a packet at a random time within the first send interval,
+// then every send interval plus jitter. Only the next send of every pair is
+// kept, so sends can be generated as the run reaches them.
+// Send times are drawn from their own generator seeded with seed, so that
+// the same sends are generated whatever else the run does with randomness.
+type arrivals struct {
+	ctx       context.Context
+	state     *simulator.State
+	rng       *simulator.Rand
+	queue     *simulator.EventHeap // next send of every pair
+	base_time time.Time
+	interval  uint32 // milliseconds
+	jitter    uint32 // milliseconds
+	left      int    // sends still to generate
+	pairs     int    // pairs sending packets
+	popped    int    // sends drawn from the queue, including those of unreachable pairs
+
+	// Pairs have been checked for routes and the unreachable ones removed
+	checked     bool
+	unreachable map[[2]string]bool
+}
+
+func newArrivals(ctx context.Context, send_interval uint32, jitter uint32, num_sends int, seed int64) (*arrivals, error) {
+	if jitter >= send_interval {
+		return nil, errors.New("jitter cannot be >= than send interval")
+	}
+
+	state, err := simulator.GetStateFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &arrivals{
+		ctx:         ctx,
+		state:       state,
+		rng:         simulator.NewRand(seed),
+		queue:       simulator.NewEventHeap(),
+		base_time:   state.Start,
+		interval:    send_interval,
+		jitter:      jitter,
+		left:        num_sends,
+		unreachable: make(map[[2]string]bool),
+	}
+
+	// Create a priority queue for send event timing
+	// Chains that join the network later also send and receive packets
+	chain_ids := state.ChainIDs()
+	for _, c1 := range chain_ids {
+		for _, c2 := range chain_ids {
+			if c1 != c2 {
+				// Enqueue event
+				a.queue.Insert(simulator.NewGenSendEvent(
+					a.genStartTime(),
+					c1,
+					c2,
+				))
+				a.pairs++
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a *arrivals) genStartTime() time.Time {
+	r := a.rng.Int63n(int64(a.interval))
+	d, _ := time.ParseDuration(fmt.Sprintf("%dms", r))
+	return a.base_time.Add(d)
+}
+
+func (a *arrivals) genSendTime() time.Time {
+	r := a.rng.Int63n(int64(a.jitter))
+	d, _ := time.ParseDuration(fmt.Sprintf("%dms", r+int64(a.interval)))
+	return a.base_time.Add(d)
+}
+
+// Returns the next send. ok is false once every send has been generated.
+func (a *arrivals) next() (send Send, ok bool, err error) {
+	for a.left > 0 {
+		next := a.queue.Pop()
+		if next == nil {
+			return Send{}, false, errors.New("queue empty")
+		}
+		a.popped++
+
+		gs_evnt := next.(*simulator.GenSendEvent)
+
+		// Routes are resolved when the packet is sent. Only check that the
+		// pair is reachable in the initial topology. Chains that join later
+		// cannot be checked yet.
+		if !a.checked && !a.state.IsReserved(gs_evnt.Src) && !a.state.IsReserved(gs_evnt.Dst) {
+			if _, err := a.state.GetRoute(a.ctx, gs_evnt.Src, gs_evnt.Dst); err != nil {
+				// Unreachable. Try another pair.
+				a.unreachable[[2]string{gs_evnt.Src, gs_evnt.Dst}] = true
+				continue
+			}
+		}
+
+		send = Send{
+			Offset: gs_evnt.Time().Sub(a.state.Start),
+			Src:    gs_evnt.Src,
+			Dst:    gs_evnt.Dst,
+		}
+
+		a.base_time = gs_evnt.Time()
+		gs_evnt.AdjustTime(a.genSendTime())
+		a.queue.Insert(gs_evnt)
+		a.left--
+		return send, true, nil
+	}
+	return Send{}, false, nil
+}
+
+// Returns the pending send of every pair, in the order they are drawn
+func (a *arrivals) pending() []*simulator.GenSendEvent {
+	var retval []*simulator.GenSendEvent
+	for next := a.queue.Pop(); next != nil; next = a.queue.Pop() {
+		retval = append(retval, next.(*simulator.GenSendEvent))
+	}
+	for _, gs := range retval {
+		a.queue.Insert(gs)
+	}
+	return retval
+}
+
+// Removes the pairs that cannot reach each other
+func (a *arrivals) prune(unreachable map[[2]string]bool) {
+	all := a.pending()
+	kept := all[:0]
+	for _, gs := range all {
+		if !unreachable[[2]string{gs.Src, gs.Dst}] {
+			kept = append(kept, gs)
+		}
+	}
+	a.queue = simulator.NewEventHeap()
+	for _, gs := range kept {
+		a.queue.Insert(gs)
+	}
+	a.pairs = len(kept)
+	a.checked = true
+}
+
+// Creates the arrival process of a streamed run. The pairs are checked for
+// routes first, in the same order as genSends checks them, so that a
+// streamed run finds the same routes and sends the same packets as a run
+// with generated sends. The sends themselves are generated as the run goes.
+func streamArrivals(ctx context.Context, send_interval uint32, jitter uint32, num_sends int, seed int64) (*arrivals, error) {
+	check, err := newArrivals(ctx, send_interval, jitter, num_sends, seed)
+	if err != nil {
+		return nil, err
+	}
+	logHubs(ctx, check.state)
+
+	// Every pair draws its first send before any pair draws its second, so
+	// every pair has been checked once as many sends as pairs are drawn
+	for check.popped < check.pairs {
+		if _, ok, err := check.next(); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+	}
+
+	a, err := newArrivals(ctx, send_interval, jitter, num_sends, seed)
+	if err != nil {
+		return nil, err
+	}
+	a.prune(check.unreachable)
+	return a, nil
+}
+
+// arrivalsSnapshot is the state of the arrival process of a streamed run.
+type arrivalsSnapshot struct {
+	Rand    uint64
+	Base    time.Duration // time of the last send, since the start of the run
+	Left    int
+	Pending []Send // next send of every pair, in the order they are drawn
+}
+
+func (a *arrivals) snapshot() *arrivalsSnapshot {
+	snap := &arrivalsSnapshot{
+		Rand: a.rng.State,
+		Base: a.base_time.Sub(a.state.Start),
+		Left: a.left,
+	}
+	for _, gs := range a.pending() {
+		snap.Pending = append(snap.Pending, Send{Offset: gs.Time().Sub(a.state.Start), Src: gs.Src, Dst: gs.Dst})
+	}
+	return snap
+}
+
+// Restores the arrival process of a streamed run from a snapshot
+func restoreArrivals(ctx context.Context, snap *arrivalsSnapshot, send_interval uint32, jitter uint32) (*arrivals, error) {
+	state, err := simulator.GetStateFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &arrivals{
+		ctx:       ctx,
+		state:     state,
+		rng:       &simulator.Rand{State: snap.Rand},
+		queue:     simulator.NewEventHeap(),
+		base_time: state.Start.Add(snap.Base),
+		interval:  send_interval,
+		jitter:    jitter,
+		left:      snap.Left,
+		pairs:     len(snap.Pending),
+		checked:   true,
+	}
+	for _, send := range snap.Pending {
+		a.queue.Insert(simulator.NewGenSendEvent(state.Start.Add(send.Offset), send.Src, send.Dst))
+	}
+	return a, nil
+}
+
+// sendSource feeds the sends of an arrival process to a run as it reaches
+// them.
+type sendSource struct {
+	arrivals *arrivals
+	start    time.Time
+	multi    bool
+
+	// Sends are written to events once set. The last send returned before
+	// is kept until then.
+	events *simulator.EventWriter
+	last   simulator.Event
+}
+
+func (s *sendSource) Next() simulator.Event {
+	// Unreachable pairs are removed beforehand, so no error can end the
+	// sends early
+	send, ok, _ := s.arrivals.next()
+	if !ok {
+		s.last = nil
+		return nil
+	}
+
+	e := sendEvent(s.start, send, s.multi)
+	if s.events != nil {
+		s.events.Write(e)
+	} else {
+		s.last = e
+	}
+	return e
+}
+
+// Writes the sends to w from the one waiting in the queue on
+func (s *sendSource) writeTo(w *simulator.EventWriter) {
+	if s.last != nil {
+		w.Write(s.last)
+		s.last = nil
+	}
+	s.events = w
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// The last custom event type, out of the way of the types registered from
+// FIRST_CUSTOM_EVENT_TYPE on
+const BENCH_EVENT_TYPE = math.MaxUint64
+
+type benchData struct {
+	Spread int64 `json:"spread"`
+}
+
+// Registers the bench event type, which is only needed by the benchmarks
+func registerBenchEvent() error {
+	return simulator.RegisterEventType(BENCH_EVENT_TYPE, "bench",
+		func(e *benchEvent) benchData { return benchData{e.spread} },
+		func(t time.Time, d benchData) *benchEvent { return &benchEvent{event_time: t, spread: d.Spread} })
+}
+
+// benchEvent does no work, so that benchmarks only measure the queue. Events
+// of the hold benchmark schedule the next event when they run.
+type benchEvent struct {
+	event_time time.Time
+	q          *simulator.EventQueue // set for the hold benchmark
+	spread     int64                 // nanoseconds over which the next event is scheduled
+}
+
+func (e *benchEvent) Execute(ctx context.Context) {
+	if e.q == nil {
+		return
+	}
+	t := e.event_time.Add(time.Duration(e.q.BatonState.Rand.Int63n(e.spread)))
+	e.q.Enqueue(&benchEvent{event_time: t, q: e.q, spread: e.spread})
+}
+
+func (e *benchEvent) Type() uint64 {
+	return BENCH_EVENT_TYPE
+}
+
+func (e *benchEvent) Copy() simulator.Event {
+	c := *e
+	return &c
+}
+
+func (e *benchEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *benchEvent) AddMsg() {
+}
+
+func (e *benchEvent) SubEvents() []simulator.Event {
+	return nil
+}
+
+func (e *benchEvent) Following() []simulator.Event {
+	return nil
+}
+
+func (e *benchEvent) SetFollowing([]simulator.Event) {
+}
+
+func (e *benchEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
+
+// Creates an empty queue of the given kind
+func benchQueue(kind string, seed int64) *simulator.EventQueue {
+	q := simulator.NewEventQueue()
+	q.BatonState.Log = nil
+	q.BatonState.Rand = simulator.NewRand(seed)
+	if kind == "calendar" {
+		q.UseCalendarQueue()
+	}
+	return q
+}
+
+// Memory in use, in megabytes, after a garbage collection
+func heapMB() float64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return float64(m.HeapAlloc) / (1 << 20)
+}
+
+func printBench(name string, kind string, n int, d time.Duration) {
+	fmt.Printf("Bench: %s %s -- %d events | %v | %.0f ns/event | %.2fM events/s\n",
+		kind, name, n, d.Round(time.Millisecond), float64(d.Nanoseconds())/float64(n), float64(n)/d.Seconds()/1e6)
+}
+
+// Loads n events spread over n milliseconds in one go, then runs them all
+func benchLoad(kind string, n int, seed int64) {
+	q := benchQueue(kind, seed)
+	start := q.BatonState.Start
+	span := int64(n) * int64(time.Millisecond)
+
+	began := time.Now()
+	for i := 0; i < n; i++ {
+		q.AddEventToLoad(&benchEvent{event_time: start.Add(time.Duration(q.BatonState.Rand.Int63n(span)))})
+	}
+	q.LoadEventsIntoQueue()
+	printBench("load", kind, n, time.Since(began))
+	fmt.Printf("Bench: %s memory -- %.0f MB for %d events\n", kind, heapMB(), q.Len())
+
+	ctx := context.Background()
+	began = time.Now()
+	for q.Step(ctx) == nil {
+	}
+	printBench("run", kind, n, time.Since(began))
+}
+
+// Keeps size events in the queue while n events run, each scheduling
+// another one up to a second later. This is the classic hold model of
+// event queue benchmarks.
+func benchHold(kind string, n int, size int, seed int64) {
+	q := benchQueue(kind, seed)
+	start := q.BatonState.Start
+	spread := int64(time.Second)
+	for i := 0; i < size; i++ {
+		q.AddEventToLoad(&benchEvent{event_time: start.Add(time.Duration(q.BatonState.Rand.Int63n(spread))), q: q, spread: spread})
+	}
+	q.LoadEventsIntoQueue()
+
+	ctx := context.Background()
+	began := time.Now()
+	for i := 0; i < n; i++ {
+		q.Step(ctx)
+	}
+	printBench(fmt.Sprintf("hold %d", size), kind, n, time.Since(began))
+}
+
+// Runs a quiet scenario to the end and reports the events it ran
+func benchScenario(kind string, sc Scenario) error {
+	sc.Queue = kind
+	sc.Quiet = true
+	run, err := setupScenario(&sc)
+	if err != nil {
+		return err
+	}
+
+	began := time.Now()
+	n := 0
+	for run.Queue.Step(run.Ctx) == nil {
+		n++
+	}
+	printBench(fmt.Sprintf("scenario %d sends", sc.Sends), kind, n, time.Since(began))
+	return nil
+}
+
+// runBench benchmarks the event queues. Given an edges csv file, it also
+// runs a scenario over that topology.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	sc := defaultScenario()
+	bindScenarioFlags(fs, &sc)
+	events := fs.Int("n", 20000000, "events to load and run")
+	hold := fs.Int("hold", 1000000, "events kept in the queue by the hold benchmark. 0 to skip it")
+	queue := fs.String("queues", "heap,calendar", "queues to benchmark")
+	fs.Int64Var(&sc.Sends, "sends", 100000, "sends of the scenario benchmark")
+	fs.Parse(args)
+
+	if err := registerBenchEvent(); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	var kinds []string
+	for _, kind := range strings.Split(*queue, ",") {
+		if kind != "heap" && kind != "calendar" {
+			fmt.Printf("unknown queue %s\n", kind)
+			return
+		}
+		kinds = append(kinds, kind)
+	}
+
+	for _, kind := range kinds {
+		benchLoad(kind, *events, sc.Seed)
+		if *hold > 0 {
+			benchHold(kind, *events, *hold, sc.Seed)
+		}
+	}
+
+	if fs.NArg() < 1 {
+		return
+	}
+	sc.Edges = fs.Arg(0)
+	for _, kind := range kinds {
+		if err := benchScenario(kind, sc); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return
+		}
+	}
+}
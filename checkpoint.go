@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Checkpoint is a run paused at a point in time. It holds everything needed
+// to resume the run, possibly with different options.
+type Checkpoint struct {
+	Scenario Scenario
+	Faults   []*simulator.Fault
+	Changes  []*simulator.TopologyChange
+	Sends    []Send
+	Arrivals *arrivalsSnapshot // sends still to generate in a streamed run
+	Snapshot *simulator.Snapshot
+}
+
+// CheckpointOptions selects when a run is paused and where the checkpoint is written.
+type CheckpointOptions struct {
+	File string
+	At   int64 // milliseconds since the start of the simulation
+}
+
+func bindCheckpointFlags(fs *flag.FlagSet, cp *CheckpointOptions) {
+	fs.StringVar(&cp.File, "checkpoint", "", "file to write a checkpoint of the run to. The run stops at the checkpoint")
+	fs.Int64Var(&cp.At, "checkpoint-at", 0, "milliseconds since the start of the simulation at which to write the checkpoint")
+}
+
+// run steps through the events of the run. If a checkpoint is asked for, the run
+// stops at the checkpoint time, the checkpoint is written and true is returned.
+// Otherwise, the run is finished and false is returned.
+func (cp *CheckpointOptions) run(run *Run) bool {
+	if cp.File == "" {
+		run.Finish()
+		return false
+	}
+
+	at := run.State().Start.Add(time.Duration(cp.At) * time.Millisecond)
+	run.RunUntil(at)
+	if run.Queue.Next() == nil {
+		fmt.Printf("Run finished before the checkpoint at %dms\n", cp.At)
+		return false
+	}
+
+	if err := writeCheckpoint(cp.File, run); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return true
+	}
+	fmt.Printf("Checkpoint written to %s at %dms: %d events pending\n", cp.File, cp.At, run.Queue.Len())
+	return true
+}
+
+func writeCheckpoint(filename string, run *Run) error {
+	snap, err := run.Queue.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	cp := &Checkpoint{
+		Scenario: *run.Scenario,
+		Faults:   run.Faults,
+		Changes:  run.Changes,
+		Sends:    run.Sends,
+		Snapshot: snap,
+	}
+	if run.Source != nil {
+		cp.Arrivals = run.Source.arrivals.snapshot()
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+func readCheckpoint(filename string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if cp.Snapshot == nil {
+		return nil, fmt.Errorf("%s is not a checkpoint", filename)
+	}
+	return cp, nil
+}
+
+// resumeCheckpoint restores the run of a checkpoint. The scenario replaces the
+// checkpoint's scenario for the options in set, which name the flags given
+// when resuming. Faults and topology changes given when resuming are added to
+// those of the checkpoint and must not start before it.
+func resumeCheckpoint(cp *Checkpoint, sc *Scenario, set map[string]bool) (*Run, error) {
+	q, err := simulator.RestoreQueue(cp.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{Scenario: sc, Queue: q, Faults: cp.Faults, Changes: cp.Changes, Sends: cp.Sends}
+	state := q.BatonState
+	if sc.Quiet {
+		state.Log = nil
+	}
+	run.Ctx = scenarioContext(sc, state)
+
+	// The sends of a streamed run go on from where they stopped
+	if cp.Arrivals != nil {
+		a, err := restoreArrivals(run.Ctx, cp.Arrivals, uint32(cp.Scenario.SendInterval), uint32(cp.Scenario.Jitter))
+		if err != nil {
+			return nil, err
+		}
+		run.Source = &sendSource{arrivals: a, start: state.Start, multi: cp.Scenario.ChannelType == "multi"}
+		if err := q.ResumeSource(0, run.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	if set["seed"] {
+		state.Rand = simulator.NewRand(sc.Seed)
+	}
+	if set["update-failures"] || set["deliver-failures"] || set["max-retries"] || set["retry-delay"] || set["retry-backoff"] || set["packet-timeout"] {
+		if err := configureFailures(state, sc); err != nil {
+			return nil, err
+		}
+	}
+	if set["acks"] {
+		state.Acks = sc.Acks
+	}
+	if set["gas"] {
+		if state.Gas, err = readGasSchedule(sc.Gas, state.Chains); err != nil {
+			return nil, err
+		}
+	}
+	if set["batch-size"] || set["batch-window"] {
+		configureBatching(state, sc)
+	}
+	if sc.RecordBlocks && state.Recorder == nil {
+		state.Recorder = simulator.NewRecorder()
+	}
+
+	if set["faults"] {
+		faults, err := readFaults(sc.Faults, state.Chains, state.Start)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range faults {
+			if f.Start.Before(state.Time) {
+				return nil, fmt.Errorf("fault %s starts before the checkpoint", f)
+			}
+			state.Enqueue(simulator.NewFaultEvent(f.Start, f, true))
+			state.Enqueue(simulator.NewFaultEvent(f.End, f, false))
+		}
+		run.Faults = append(run.Faults, faults...)
+
+		// Latencies of dropped packets are split by the added faults from now on
+		if state.Finished != nil {
+			var bounds []time.Time
+			for _, f := range faults {
+				bounds = append(bounds, f.Start, f.End)
+			}
+			state.DropFinished(bounds)
+		}
+	}
+
+	if set["topology-changes"] {
+		changes, err := readTopologyChanges(sc.TopologyChanges, state.Chains, state.Start)
+		if err != nil {
+			return nil, err
+		}
+		for _, tc := range changes {
+			if tc.Time.Before(state.Time) {
+				return nil, fmt.Errorf("topology change %s happens before the checkpoint", tc)
+			}
+			// Blocks are only scheduled for chains known when the run started
+			if tc.Kind == simulator.TOPOLOGY_ADD && !state.IsReserved(tc.Chain) {
+				return nil, fmt.Errorf("chain %s can only be added if it was added in the original run", tc.Chain)
+			}
+			state.Enqueue(simulator.NewTopologyEvent(tc))
+		}
+		run.Changes = append(run.Changes, changes...)
+	}
+
+	return run, nil
+}
+
+// runResume resumes a run from a checkpoint and reports its results.
+func runResume(args []string) {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	flag_sc := defaultScenario()
+	bindScenarioFlags(fs, &flag_sc)
+	out := &Outputs{}
+	bindOutputFlags(fs, out)
+	next := &CheckpointOptions{}
+	bindCheckpointFlags(fs, next)
+	trace := &TraceOptions{}
+	bindTraceFlags(fs, trace)
+	playback := &PlaybackOptions{}
+	bindPlaybackFlags(fs, playback)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Printf("Format: main.go resume [options] [checkpoint file]\nOptions:\n")
+		fs.PrintDefaults()
+		return
+	}
+
+	cp, err := readCheckpoint(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	// The checkpoint's scenario gives the defaults of the options, so only
+	// the options that were set are applied to it
+	sc := cp.Scenario
+	scenario_flags := flag.NewFlagSet("resume", flag.ContinueOnError)
+	bindScenarioFlags(scenario_flags, &sc)
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if scenario_flags.Lookup(f.Name) != nil {
+			scenario_flags.Set(f.Name, f.Value.String())
+		}
+	})
+	if err := out.configure(&sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	run, err := resumeCheckpoint(cp, &sc, set)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	if executeRun(run, next, trace, playback) {
+		return
+	}
+	out.report(run)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Mode is a way of routing packets between chains.
+type Mode struct {
+	Name        string
+	Description string
+	ChannelType string
+	Direct      bool
+}
+
+// The modes that are compared. The first one is the baseline.
+var compareModes = []Mode{
+	{"baton", "multi-hop Baton channels", "multi", false},
+	{"single", "single-hop channels", "single", false},
+	{"hub", "single-hop channels through hub chains", "single", true},
+}
+
+// Mean latency, in milliseconds, of the packets delivered to each chain
+func latencyByDst(state *simulator.State) map[string]float64 {
+	means := make(map[string]float64)
+	for dst, d := range state.LatenciesByDst() {
+		means[dst] = d.Mean()
+	}
+	return means
+}
+
+// Formats a value with at most 6 decimals
+func formatValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+// Formats a value of a mode next to its difference from the baseline
+func withDelta(value, base float64) string {
+	delta := formatValue(value - base)
+	if value >= base {
+		delta = "+" + delta
+	}
+	return fmt.Sprintf("%s (%s)", formatValue(value), delta)
+}
+
+// Prints how the modes differ from the baseline, which is the first mode
+func printComparison(modes []Mode, results []result, hubs []string) {
+	base := results[0]
+	base_state := base.State
+
+	fmt.Printf("Compare: seed %d | sends %d\n", base.Scenario.Seed, len(base.Sends))
+	for _, mode := range modes {
+		fmt.Printf("Mode: %s -- %s\n", mode.Name, mode.Description)
+	}
+
+	// Summary metrics
+	for i, m := range base.Metrics {
+		fmt.Printf("Summary: %s -- %s %s", m.Name, modes[0].Name, formatValue(m.Value))
+		for j := 1; j < len(modes); j++ {
+			fmt.Printf(" | %s %s", modes[j].Name, withDelta(results[j].Metrics[i].Value, m.Value))
+		}
+		fmt.Printf("\n")
+	}
+
+	// Transactions and latency per chain
+	latencies := make([]map[string]float64, len(results))
+	for j, r := range results {
+		latencies[j] = latencyByDst(r.State)
+	}
+
+	chain_ids := base_state.ChainIDs()
+	for _, id := range chain_ids {
+		fmt.Printf("Chain tx: %s -- %s %d", id, modes[0].Name, totalTx(base_state, id))
+		for j := 1; j < len(modes); j++ {
+			fmt.Printf(" | %s %s", modes[j].Name, withDelta(float64(totalTx(results[j].State, id)), float64(totalTx(base_state, id))))
+		}
+		fmt.Printf("\n")
+	}
+
+	for _, id := range chain_ids {
+		fmt.Printf("Chain latency: %s -- %s %.2fms", id, modes[0].Name, latencies[0][id])
+		for j := 1; j < len(modes); j++ {
+			fmt.Printf(" | %s %.2fms (%+.2fms)", modes[j].Name, latencies[j][id], latencies[j][id]-latencies[0][id])
+		}
+		fmt.Printf("\n")
+	}
+
+	// Load on the hub chains
+	for _, hub := range hubs {
+		ch, ok := base_state.Chains[hub]
+		if !ok {
+			continue
+		}
+
+		fmt.Printf("Hub load: %s -- %s total %d max %d", hub, modes[0].Name, ch.TotalTx(), ch.GetMaxTxCount())
+		for j := 1; j < len(modes); j++ {
+			other, ok := results[j].State.Chains[hub]
+			if !ok {
+				continue
+			}
+			fmt.Printf(" | %s total %s max %s", modes[j].Name,
+				withDelta(float64(other.TotalTx()), float64(ch.TotalTx())),
+				withDelta(float64(other.GetMaxTxCount()), float64(ch.GetMaxTxCount())))
+		}
+		fmt.Printf("\n")
+	}
+
+	// Chains that carry fewer transactions than in the baseline benefit from the mode
+	for j := 1; j < len(modes); j++ {
+		deltas := make(map[string]int)
+		for _, id := range chain_ids {
+			deltas[id] = totalTx(results[j].State, id) - totalTx(base_state, id)
+		}
+
+		ids := append([]string{}, chain_ids...)
+		sort.SliceStable(ids, func(a, b int) bool {
+			return deltas[ids[a]] < deltas[ids[b]]
+		})
+
+		winners := make([]string, 0)
+		losers := make([]string, 0)
+		for _, id := range ids {
+			if deltas[id] < 0 {
+				winners = append(winners, fmt.Sprintf("%s (%d)", id, deltas[id]))
+			}
+		}
+		for i := len(ids) - 1; i >= 0; i-- {
+			if deltas[ids[i]] > 0 {
+				losers = append(losers, fmt.Sprintf("%s (%+d)", ids[i], deltas[ids[i]]))
+			}
+		}
+
+		fmt.Printf("Versus %s: %s -- benefit: %s | lose: %s\n", modes[0].Name, modes[j].Name,
+			strings.Join(winners, ", "), strings.Join(losers, ", "))
+	}
+}
+
+// Total transactions of a chain, or 0 if the chain is not part of the network
+func totalTx(state *simulator.State, chain_id string) int {
+	if ch, ok := state.Chains[chain_id]; ok {
+		return ch.TotalTx()
+	}
+	return 0
+}
+
+// Sets the scenario from the positional arguments of a comparison: the edges
+// csv file, send interval, jitter, number of sends and hubs
+func parseCompareArgs(args []string, sc *Scenario) error {
+	var err error
+	sc.Edges = args[0]
+	sc.SendInterval, err = strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("send interval not the correct format")
+	}
+	sc.Jitter, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("jitter not the correct format")
+	}
+	sc.Sends, err = strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return fmt.Errorf("'number of sends' not the correct format")
+	}
+	sc.Hubs = args[4:]
+	return nil
+}
+
+// runCompare runs the same sends through every mode and prints how they differ.
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	sc := defaultScenario()
+	bindScenarioFlags(fs, &sc)
+	fs.Parse(args)
+
+	usage := func() {
+		fmt.Printf("Format: main.go compare [options] [edges csv file] [send interval] [jitter] [number of sends] [hubs...]\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	if fs.NArg() < 4 {
+		usage()
+		return
+	}
+	if err := parseCompareArgs(fs.Args(), &sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		usage()
+		return
+	}
+	sc.Quiet = true
+
+	// The other modes replay the baseline's sends, so they must be kept
+	sc.Stream = false
+
+	// The baseline generates the sends. Every other mode replays them.
+	scenarios := make([]Scenario, len(compareModes))
+	for i, mode := range compareModes {
+		scenarios[i] = sc
+		scenarios[i].ChannelType = mode.ChannelType
+		scenarios[i].Direct = mode.Direct
+	}
+
+	base := runAll(scenarios[:1], 1, true)
+	if base[0].Err != nil {
+		fmt.Printf("%s\n", base[0].Err.Error())
+		return
+	}
+	for i := 1; i < len(scenarios); i++ {
+		scenarios[i].Workload = base[0].Sends
+	}
+
+	results := append(base, runAll(scenarios[1:], len(scenarios)-1, true)...)
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%s\n", r.Err.Error())
+			return
+		}
+	}
+
+	printComparison(compareModes, results, sc.Hubs)
+}
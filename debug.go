@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Breakpoint stops the debugger before an event of a kind, an event that
+// involves a chain, or an event of a packet runs.
+type Breakpoint struct {
+	On    string // 'type', 'chain' or 'packet'
+	Value string
+}
+
+func (b Breakpoint) String() string {
+	return fmt.Sprintf("%s %s", b.On, b.Value)
+}
+
+// Debugger steps through a run event by event.
+type Debugger struct {
+	run    *Run
+	out    *Outputs
+	w      io.Writer
+	breaks []Breakpoint
+}
+
+// Describes an event by its time since the start, its kind and its data
+func describeEvent(e simulator.Event, start time.Time) string {
+	entry, err := simulator.NewEventEntry(e, start)
+	if err != nil {
+		return fmt.Sprintf("%v event of type %d", e.Time().Sub(start), e.Type())
+	}
+	return fmt.Sprintf("%s %s %s", entry.At, entry.Kind, entry.Data)
+}
+
+// Whether the event matches the breakpoint. Chains and packets are matched
+// against the event's data, so breakpoints work for every event type.
+func (b Breakpoint) matches(e simulator.Event) bool {
+	entry, err := simulator.NewEventEntry(e, time.Time{})
+	if err != nil {
+		return false
+	}
+	if b.On == "type" {
+		return entry.Kind == b.Value
+	}
+
+	fields := make(map[string]any)
+	json.Unmarshal(entry.Data, &fields)
+	for key, v := range fields {
+		switch b.On {
+		case "chain":
+			if s, ok := v.(string); ok && s == b.Value {
+				return true
+			}
+		case "packet":
+			if n, ok := v.(float64); ok && key == "packet" && strconv.FormatFloat(n, 'f', -1, 64) == b.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Time since the start of the run. Nothing has happened before the first event.
+func (d *Debugger) elapsed(t time.Time) time.Duration {
+	start := d.run.State().Start
+	if t.Before(start) {
+		return 0
+	}
+	return t.Sub(start)
+}
+
+// Returns the breakpoint that the event hits, if any
+func (d *Debugger) hit(e simulator.Event) (int, bool) {
+	for i, b := range d.breaks {
+		if b.matches(e) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Runs events until n have run, the next event is at or after until, a
+// breakpoint is hit or the queue is empty. The first event always runs, so
+// that a stopped run can move past its breakpoint.
+func (d *Debugger) advance(n int, until time.Time, verbose bool) {
+	q := d.run.Queue
+	start := d.run.State().Start
+	for i := 0; n < 0 || i < n; i++ {
+		next := q.Next()
+		if next == nil {
+			fmt.Fprintf(d.w, "Queue is empty at %v\n", d.elapsed(d.run.State().Time))
+			return
+		}
+		if !until.IsZero() && !next.Time().Before(until) {
+			fmt.Fprintf(d.w, "Stopped at %v\n", until.Sub(start))
+			return
+		}
+		if i > 0 {
+			if b, ok := d.hit(next); ok {
+				fmt.Fprintf(d.w, "Breakpoint %d (%s): %s\n", b, d.breaks[b], describeEvent(next, start))
+				return
+			}
+		}
+
+		if verbose {
+			fmt.Fprintf(d.w, "Step: %s\n", describeEvent(next, start))
+		}
+		q.Step(d.run.Ctx)
+	}
+}
+
+func (d *Debugger) printChains() {
+	state := d.run.State()
+	for _, id := range state.ChainIDs() {
+		ch, ok := state.Chains[id]
+		if !ok {
+			fmt.Fprintf(d.w, "Chain: %s -- not added yet\n", id)
+			continue
+		}
+		fmt.Fprintf(d.w, "Chain: %s -- height %d | block tx %d | total tx %d | neighbours %d\n",
+			id, ch.GetHeight(), ch.TxCount(), ch.TotalTx(), len(ch.GetNeighbours()))
+	}
+}
+
+func (d *Debugger) printChain(id string) error {
+	state := d.run.State()
+	ch, ok := state.Chains[id]
+	if !ok {
+		return fmt.Errorf("could not find chain %s", id)
+	}
+
+	fmt.Fprintf(d.w, "Chain: %s -- height %d | last block %v | block tx %d | block msgs %d | total tx %d | total msgs %d\n",
+		id, ch.GetHeight(), d.elapsed(ch.LastBlockTime()), ch.TxCount(), ch.MsgCount(), ch.TotalTx(), ch.TotalMsgs())
+
+	neighbours := make([]string, 0)
+	for n := range ch.GetNeighbours() {
+		neighbours = append(neighbours, n)
+	}
+	sort.Strings(neighbours)
+	for _, n := range neighbours {
+		other := state.Chains[n]
+		fmt.Fprintf(d.w, "View: %s of %s -- %d | actual %d | behind %d\n",
+			id, n, ch.GetView(n), other.GetHeight(), other.GetHeight()-ch.GetView(n))
+	}
+	return nil
+}
+
+func (d *Debugger) printPacket(arg string) error {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return fmt.Errorf("packet id not the correct format")
+	}
+	state := d.run.State()
+	p, ok := state.Packets[id]
+	if !ok && state.Finished != nil {
+		return fmt.Errorf("could not find packet %d. Finished packets are dropped when streaming", id)
+	} else if !ok {
+		return fmt.Errorf("could not find packet %d", id)
+	}
+
+	status := "in flight"
+	switch {
+	case p.Delivered:
+		status = fmt.Sprintf("delivered after %v", p.Latency())
+	case p.TimedOut:
+		status = "timed out"
+	case p.Lost:
+		status = "lost"
+	}
+	fmt.Fprintf(d.w, "Packet: %d -- %s > %s | sent %v | %s | attempts %d\n",
+		p.ID, p.Src, strings.Join(p.Hops, " > "), p.SentAt.Sub(state.Start), status, p.Attempts)
+	return nil
+}
+
+// Prints the first n pending events in the order they run
+func (d *Debugger) printQueue(n int) {
+	q := d.run.Queue
+	pending := q.Pending()
+	start := d.run.State().Start
+
+	fmt.Fprintf(d.w, "Queue: %d events pending\n", len(pending))
+	for i, e := range pending {
+		if n >= 0 && i >= n {
+			break
+		}
+		fmt.Fprintf(d.w, "%d: %s\n", i, describeEvent(e, start))
+	}
+}
+
+const debugHelp = `Commands:
+  step [n]                 run the next n events (default 1), printing each
+  continue                 run until a breakpoint is hit or the queue is empty
+  until [ms]               run the events before the given milliseconds since the start
+  break type [kind]        stop before events of a kind, e.g. 'update'
+  break chain [chain]      stop before events that involve a chain
+  break packet [id]        stop before events of a packet
+  breaks                   list the breakpoints
+  delete [n]               delete breakpoint n, or every breakpoint if n is not given
+  chains                   print the height and load of every chain
+  chain [chain]            print a chain and its views of its neighbours
+  packet [id]              print a packet
+  queue [n]                print the next n pending events (default 10), or all with 'all'
+  time                     print the simulation time
+  report                   print the reports of the run so far
+  quit                     leave the debugger
+`
+
+// exec runs one command. It returns false when the debugger should stop.
+func (d *Debugger) exec(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true, nil
+	}
+	args := fields[1:]
+
+	switch fields[0] {
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return true, fmt.Errorf("number of steps not the correct format")
+			}
+		}
+		d.advance(n, time.Time{}, true)
+	case "continue", "c":
+		d.advance(-1, time.Time{}, false)
+	case "until", "u":
+		if len(args) < 1 {
+			return true, fmt.Errorf("until needs a time in milliseconds")
+		}
+		ms, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return true, fmt.Errorf("time not the correct format")
+		}
+		d.advance(-1, d.run.State().Start.Add(time.Duration(ms)*time.Millisecond), false)
+	case "break", "b":
+		if len(args) < 2 || (args[0] != "type" && args[0] != "chain" && args[0] != "packet") {
+			return true, fmt.Errorf("break needs 'type', 'chain' or 'packet' and a value")
+		}
+		if args[0] == "type" {
+			if _, ok := simulator.LookupEventName(args[1]); !ok {
+				return true, fmt.Errorf("unknown event kind %s", args[1])
+			}
+		}
+		d.breaks = append(d.breaks, Breakpoint{On: args[0], Value: args[1]})
+		fmt.Fprintf(d.w, "Breakpoint %d: %s\n", len(d.breaks)-1, d.breaks[len(d.breaks)-1])
+	case "breaks":
+		for i, b := range d.breaks {
+			fmt.Fprintf(d.w, "Breakpoint %d: %s\n", i, b)
+		}
+	case "delete":
+		if len(args) == 0 {
+			d.breaks = nil
+			break
+		}
+		i, err := strconv.Atoi(args[0])
+		if err != nil || i < 0 || i >= len(d.breaks) {
+			return true, fmt.Errorf("no breakpoint %s", args[0])
+		}
+		d.breaks = append(d.breaks[:i], d.breaks[i+1:]...)
+	case "chains":
+		d.printChains()
+	case "chain":
+		if len(args) < 1 {
+			return true, fmt.Errorf("chain needs a chain id")
+		}
+		return true, d.printChain(args[0])
+	case "packet", "p":
+		if len(args) < 1 {
+			return true, fmt.Errorf("packet needs a packet id")
+		}
+		return true, d.printPacket(args[0])
+	case "queue", "q":
+		n := 10
+		if len(args) > 0 {
+			if args[0] == "all" {
+				n = -1
+			} else if v, err := strconv.Atoi(args[0]); err == nil {
+				n = v
+			} else {
+				return true, fmt.Errorf("number of events not the correct format")
+			}
+		}
+		d.printQueue(n)
+	case "time", "t":
+		fmt.Fprintf(d.w, "Time: %v | %d events pending\n", d.elapsed(d.run.State().Time), d.run.Queue.Len())
+	case "report":
+		d.out.report(d.run)
+	case "help", "h":
+		fmt.Fprint(d.w, debugHelp)
+	case "quit", "exit":
+		return false, nil
+	default:
+		return true, fmt.Errorf("unknown command %s. Type 'help' for the commands", fields[0])
+	}
+	return true, nil
+}
+
+// Reads commands until the input ends or the debugger is quit
+func (d *Debugger) repl(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprintf(d.w, "(debug) ")
+		if !scanner.Scan() {
+			fmt.Fprintf(d.w, "\n")
+			return
+		}
+		more, err := d.exec(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(d.w, "%s\n", err.Error())
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// runDebug sets up a run and steps through it interactively.
+func runDebug(args []string) {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	sc := defaultScenario()
+	bindScenarioFlags(fs, &sc)
+	out := &Outputs{}
+	bindOutputFlags(fs, out)
+	fs.Parse(args)
+
+	usage := func() {
+		fmt.Printf("Format: main.go debug [options] [edges csv file] [channel_type] [send interval] [jitter] [number of sends] [direct] [hubs...]\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	if fs.NArg() < 5 {
+		usage()
+		return
+	}
+	if err := parseScenarioArgs(fs.Args(), &sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		usage()
+		return
+	}
+	if err := out.configure(&sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		usage()
+		return
+	}
+
+	run, err := setupScenario(&sc)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	d := &Debugger{run: run, out: out, w: os.Stdout}
+	fmt.Printf("Debugging %s: %d events pending. Type 'help' for the commands.\n", sc.Edges, run.Queue.Len())
+	d.repl(os.Stdin)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+func TestBreakpointMatches(t *testing.T) {
+	at := time.Unix(0, 0)
+	update := simulator.NewUpdateEvent(at, 7, "a", "b")
+	tests := []struct {
+		b     Breakpoint
+		e     simulator.Event
+		match bool
+	}{
+		{Breakpoint{"type", "update"}, update, true},
+		{Breakpoint{"type", "deliver"}, update, false},
+		{Breakpoint{"chain", "b"}, update, true},
+		{Breakpoint{"chain", "c"}, update, false},
+		{Breakpoint{"packet", "7"}, update, true},
+		{Breakpoint{"packet", "8"}, update, false},
+		{Breakpoint{"chain", "x"}, simulator.NewSendEvent(at, "x", "y"), true},
+		{Breakpoint{"packet", "7"}, simulator.NewHeightEvent(at, "7"), false},
+	}
+	for _, test := range tests {
+		if got := test.b.matches(test.e); got != test.match {
+			t.Fatalf("breakpoint %s matches %s: %v, want %v", test.b, describeEvent(test.e, at), got, test.match)
+		}
+	}
+}
+
+// Sets up a debugger writing to a buffer
+func newTestDebugger(t *testing.T) (*Debugger, *strings.Builder) {
+	sc := testScenario(writeTestEdges(t))
+	run, err := setupScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &strings.Builder{}
+	return &Debugger{run: run, out: &Outputs{}, w: out}, out
+}
+
+// Commands stop at breakpoints and times, and the debugger stops reading at quit
+func TestDebuggerCommands(t *testing.T) {
+	d, out := newTestDebugger(t)
+	state := d.run.State()
+
+	d.repl(strings.NewReader("break type deliver\ncontinue\n"))
+	if next := d.run.Queue.Next(); next == nil || next.Type() != simulator.DELIVER_EVENT_TYPE {
+		t.Fatalf("stopped before %v, want a delivery", next)
+	}
+	if !strings.Contains(out.String(), "Breakpoint 0 (type deliver): ") {
+		t.Fatalf("breakpoint not reported:\n%s", out.String())
+	}
+
+	// Stepping moves past the breakpoint
+	d.repl(strings.NewReader("step\ndelete\nuntil 5000\n"))
+	until := state.Start.Add(5 * time.Second)
+	if next := d.run.Queue.Next(); state.Time.After(until) || next == nil || next.Time().Before(until) {
+		t.Fatalf("stopped at %v before %v, want 5s", state.Time.Sub(state.Start), next)
+	}
+	if !strings.Contains(out.String(), "Step: ") || !strings.Contains(out.String(), "Stopped at 5s") {
+		t.Fatalf("step and until not reported:\n%s", out.String())
+	}
+
+	out.Reset()
+	d.repl(strings.NewReader("queue 3\nbreak packet\nfoo\nquit\ncontinue\n"))
+	for _, want := range []string{"\n0: ", "\n2: ", "break needs 'type', 'chain' or 'packet' and a value", "unknown command foo"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output has no %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "\n3: ") || strings.Contains(out.String(), "Queue is empty") {
+		t.Fatalf("debugger ran past quit:\n%s", out.String())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Counts the distinct routes used by packets that cross each connection
+func routesPerConnection(state *simulator.State) map[string]int {
+	routes := make(map[string]map[string]bool)
+	for _, hops := range state.PacketRoutes() {
+		route := strings.Join(hops, ">")
+		prev := hops[0]
+		for _, hop := range hops[1:] {
+			key := simulator.ConnectionKey(prev, hop)
+			if _, ok := routes[key]; !ok {
+				routes[key] = make(map[string]bool)
+			}
+			routes[key][route] = true
+			prev = hop
+		}
+	}
+
+	counts := make(map[string]int)
+	for key, r := range routes {
+		counts[key] = len(r)
+	}
+	return counts
+}
+
+// writeDOT writes the chain graph in Graphviz DOT format. The size of a chain
+// reflects its most transactions in a block and its colour, from green to red,
+// its total transactions. Connections are thicker the more routes cross them.
+// Hubs are drawn with a double outline.
+func writeDOT(w io.Writer, state *simulator.State, hubs []string) error {
+	chain_ids := make([]string, 0, len(state.Chains))
+	max_tx, max_total := 0, 0
+	for _, id := range state.ChainIDs() {
+		if ch, ok := state.Chains[id]; ok {
+			chain_ids = append(chain_ids, id)
+			if ch.GetMaxTxCount() > max_tx {
+				max_tx = ch.GetMaxTxCount()
+			}
+			if ch.TotalTx() > max_total {
+				max_total = ch.TotalTx()
+			}
+		}
+	}
+
+	is_hub := make(map[string]bool)
+	for _, h := range hubs {
+		is_hub[h] = true
+	}
+
+	routes := routesPerConnection(state)
+	traffic := make(map[string]simulator.Edge)
+	for _, e := range state.EdgeTable() {
+		traffic[simulator.ConnectionKey(e.A, e.B)] = e
+	}
+	max_routes := 0
+	for _, n := range routes {
+		if n > max_routes {
+			max_routes = n
+		}
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("graph baton {\n")
+	b.WriteString("\tnode [style=filled, fontname=\"Helvetica\", fixedsize=true];\n")
+	b.WriteString("\tedge [color=\"#666666\"];\n")
+
+	for _, id := range chain_ids {
+		ch := state.Chains[id]
+		size, heat := 0.0, 0.0
+		if max_tx > 0 {
+			size = float64(ch.GetMaxTxCount()) / float64(max_tx)
+		}
+		if max_total > 0 {
+			heat = float64(ch.TotalTx()) / float64(max_total)
+		}
+
+		shape := "circle"
+		if is_hub[id] {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(b, "\t%q [label=\"%s\\nmax %d | total %d\", shape=%s, width=%.2f, fillcolor=\"%.3f 0.7 0.9\"];\n",
+			id, id, ch.GetMaxTxCount(), ch.TotalTx(), shape, 0.9+1.1*size, 0.333*(1-heat))
+	}
+
+	for _, id := range chain_ids {
+		neighbours := make([]string, 0)
+		for n := range state.Chains[id].GetNeighbours() {
+			if n > id {
+				neighbours = append(neighbours, n)
+			}
+		}
+		sort.Strings(neighbours)
+
+		for _, n := range neighbours {
+			key := simulator.ConnectionKey(id, n)
+			width := 1.0
+			if max_routes > 0 {
+				width += 7 * float64(routes[key]) / float64(max_routes)
+			}
+			edge := traffic[key]
+			fmt.Fprintf(b, "\t%q -- %q [penwidth=%.2f, label=\"%d routes\\n%d packets | %d updates\"];\n",
+				id, n, width, routes[key], edge.Packets(), edge.Updates())
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes the DOT graph of a run to a file
+func writeDOTFile(filename string, state *simulator.State, hubs []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeDOT(file, state, hubs)
+}
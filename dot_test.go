@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Every connection crossed by a packet counts the routes over it
+func TestRoutesPerConnection(t *testing.T) {
+	sc := testScenario(writeTestEdges(t))
+	run, err := runScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := run.State()
+	counts := routesPerConnection(state)
+
+	crossing := make(map[string]map[string]bool)
+	for _, hops := range state.PacketRoutes() {
+		for i := 1; i < len(hops); i++ {
+			key := simulator.ConnectionKey(hops[i-1], hops[i])
+			if _, ok := state.Chains[hops[i-1]].GetNeighbour(hops[i]); !ok {
+				t.Fatalf("route %v crosses %s, which is not a connection", hops, key)
+			}
+			if crossing[key] == nil {
+				crossing[key] = make(map[string]bool)
+			}
+			crossing[key][strings.Join(hops, ">")] = true
+		}
+	}
+	if len(counts) != len(crossing) {
+		t.Fatalf("%d connections have routes, want %d", len(counts), len(crossing))
+	}
+	for key, routes := range crossing {
+		if counts[key] != len(routes) {
+			t.Fatalf("%d routes cross %s, want %d", counts[key], key, len(routes))
+		}
+	}
+}
+
+// The graph has every chain and connection once, with the hubs outlined twice
+func TestWriteDOT(t *testing.T) {
+	sc := testScenario(writeTestEdges(t))
+	sc.Hubs = []string{"3"}
+	run, err := runScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := writeDOT(&b, run.State(), []string{getChainID("3")}); err != nil {
+		t.Fatal(err)
+	}
+	graph := b.String()
+	if !strings.HasPrefix(graph, "graph baton {\n") || !strings.HasSuffix(graph, "}\n") {
+		t.Fatalf("graph is not closed:\n%s", graph)
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		if n := strings.Count(graph, "\t\""+getChainID(id)+"\" [label="); n != 1 {
+			t.Fatalf("chain %s is drawn %d times", id, n)
+		}
+	}
+	if n := strings.Count(graph, "shape=doublecircle"); n != 1 {
+		t.Fatalf("%d hubs drawn", n)
+	}
+	if n := strings.Count(graph, " -- "); n != 6 {
+		t.Fatalf("%d connections drawn, want 6", n)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Reads an event list, timed from the start of the simulation
+func readEvents(filename string, state *simulator.State) ([]simulator.Event, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events, err := simulator.ReadEventList(file, state.Start)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return events, nil
+}
+
+// Writes events as an event list
+func writeEvents(filename string, events []simulator.Event, state *simulator.State) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := simulator.NewEventWriter(file, state.Start)
+	for _, e := range events {
+		w.Write(e)
+	}
+	return w.Flush()
+}
+
+// TraceOptions selects where the events of a run are written to.
+type TraceOptions struct {
+	Trace  string
+	Events string
+}
+
+func bindTraceFlags(fs *flag.FlagSet, t *TraceOptions) {
+	fs.StringVar(&t.Trace, "trace", "", "file to write every event of the run to, as an event list")
+	fs.StringVar(&t.Events, "write-events", "", "file to write the events loaded for the scenario to, as an event list")
+}
+
+// start writes the events loaded for the run and starts tracing its events.
+// The sends of a streamed run are written as they are generated. The
+// returned function stops tracing once the run is over.
+func (t *TraceOptions) start(run *Run) (func() error, error) {
+	state := run.State()
+	var stops []func() error
+	stop := func() error {
+		var err error
+		for _, f := range stops {
+			if ferr := f(); err == nil {
+				err = ferr
+			}
+		}
+		return err
+	}
+
+	if t.Events != "" && run.Source == nil {
+		if err := writeEvents(t.Events, run.Loaded, state); err != nil {
+			return nil, err
+		}
+	} else if t.Events != "" {
+		file, err := os.Create(t.Events)
+		if err != nil {
+			return nil, err
+		}
+		w := simulator.NewEventWriter(file, state.Start)
+		for _, e := range run.Loaded {
+			w.Write(e)
+		}
+		run.Source.writeTo(w)
+		stops = append(stops, func() error {
+			err := w.Flush()
+			run.Source.events = nil
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		})
+	}
+
+	if t.Trace == "" {
+		return stop, nil
+	}
+
+	file, err := os.Create(t.Trace)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	run.Queue.Trace = simulator.NewEventWriter(file, state.Start)
+	stops = append(stops, func() error {
+		err := run.Queue.Trace.Flush()
+		run.Queue.Trace = nil
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	return stop, nil
+}
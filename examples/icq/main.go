@@ -0,0 +1,134 @@
+// Command icq adds interchain queries to a simulation as a custom event type.
+// A query is submitted on the querying chain, answered by a relayer on the host
+// chain one block later and the answer is submitted back on the querying chain.
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+const QUERY_EVENT_TYPE = simulator.FIRST_CUSTOM_EVENT_TYPE
+
+// QueryEvent is a query, or its answer, between two chains
+type QueryEvent struct {
+	event_time time.Time
+	following  []simulator.Event
+	Querier    string
+	Host       string
+	Answer     bool
+}
+
+type queryData struct {
+	Querier string `json:"querier"`
+	Host    string `json:"host"`
+	Answer  bool   `json:"answer,omitempty"`
+}
+
+func init() {
+	err := simulator.RegisterEventType(QUERY_EVENT_TYPE, "icq_query",
+		func(e *QueryEvent) queryData { return queryData{e.Querier, e.Host, e.Answer} },
+		func(t time.Time, d queryData) *QueryEvent {
+			return &QueryEvent{event_time: t, Querier: d.Querier, Host: d.Host, Answer: d.Answer}
+		})
+	if err != nil {
+		panic(err)
+	}
+	if err := simulator.RegisterMetric("icq_answered"); err != nil {
+		panic(err)
+	}
+}
+
+func (e *QueryEvent) Execute(ctx context.Context) {
+	sim, err := simulator.SimFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	relayer := simulator.RelayerID(e.Querier, e.Host)
+	if err := sim.Submit(e.Querier, relayer); err != nil {
+		sim.Logf("Query from %s to %s dropped. %s: %v\n", e.Querier, e.Host, err.Error(), e.Time())
+		return
+	}
+
+	if e.Answer {
+		sim.Add("icq_answered", 1)
+		sim.Logf("Query from %s to %s answered: %v\n", e.Querier, e.Host, e.Time())
+		return
+	}
+
+	// The relayer reads the answer from the host's next block
+	sim.Schedule(&QueryEvent{
+		event_time: e.Time().Add(simulator.IMPLICIT_HEIGHT_INTERVAL * time.Millisecond),
+		Querier:    e.Querier,
+		Host:       e.Host,
+		Answer:     true,
+	})
+}
+
+func (e *QueryEvent) Type() uint64 {
+	return QUERY_EVENT_TYPE
+}
+
+func (e *QueryEvent) Copy() simulator.Event {
+	copy := *e
+	return &copy
+}
+
+func (e *QueryEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *QueryEvent) AddMsg() {
+}
+
+func (e *QueryEvent) SubEvents() []simulator.Event {
+	return nil
+}
+
+func (e *QueryEvent) Following() []simulator.Event {
+	return e.following
+}
+
+func (e *QueryEvent) SetFollowing(events []simulator.Event) {
+	e.following = events
+}
+
+func (e *QueryEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
+
+func main() {
+	q := simulator.NewEventQueue()
+	state := q.BatonState
+	state.Log = nil
+	state.Rand = simulator.NewRand(1)
+
+	// A line of three chains
+	for _, id := range []string{"a", "b", "c"} {
+		state.AddChain(simulator.NewChain(id))
+	}
+	state.OpenConnection("a", "b")
+	state.OpenConnection("b", "c")
+	q.Init()
+
+	// Queries and packets share the block space of chain b
+	for i := 0; i < 20; i++ {
+		t := state.Start.Add(time.Duration(i) * 500 * time.Millisecond)
+		q.AddEventToLoad(&QueryEvent{event_time: t, Querier: "b", Host: "c"})
+		q.AddEventToLoad(simulator.NewSendEvent(t, "a", "c"))
+	}
+	q.LoadEventsIntoQueue()
+
+	ctx := simulator.NewContext(state, false, nil)
+	for q.Step(ctx) == nil {
+	}
+
+	for _, m := range simulator.Summarize(state, 10) {
+		fmt.Printf("%s: %g\n", m.Name, m.Value)
+	}
+	fmt.Printf("Custom messages on chain b: %d\n", state.Chains["b"].TotalMsgsOf(simulator.MSG_CUSTOM))
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// SweepSpec lists the values to try for each scenario parameter. Every
+// combination is run. Empty lists keep the value of the base scenario.
+//
+//	{
+//		"topologies": ["data/edges.csv"],
+//		"channel_types": ["multi", "single"],
+//		"intervals": [1000],
+//		"jitters": [100],
+//		"sends": [1000],
+//		"direct": [false, true],
+//		"hub_sets": [[], ["baton-1"]],
+//		"seeds": [1, 2, 3]
+//	}
+type SweepSpec struct {
+	Topologies   []string   `json:"topologies"`
+	ChannelTypes []string   `json:"channel_types"`
+	Intervals    []int64    `json:"intervals"`
+	Jitters      []int64    `json:"jitters"`
+	Sends        []int64    `json:"sends"`
+	Direct       []bool     `json:"direct"`
+	HubSets      [][]string `json:"hub_sets"`
+	Seeds        []int64    `json:"seeds"`
+}
+
+func readSweepSpec(filename string) (*SweepSpec, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &SweepSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+
+	if len(spec.Topologies) == 0 {
+		return nil, fmt.Errorf("sweep needs at least one topology")
+	}
+	return spec, nil
+}
+
+// Expand returns a scenario for every combination of the sweep, based on base.
+func (spec *SweepSpec) Expand(base Scenario) []Scenario {
+	scenarios := []Scenario{base}
+
+	// Replaces the scenarios with one copy for each value
+	expand := func(n int, set func(sc *Scenario, i int)) {
+		if n == 0 {
+			return
+		}
+		expanded := make([]Scenario, 0, len(scenarios)*n)
+		for _, sc := range scenarios {
+			for i := 0; i < n; i++ {
+				next := sc
+				set(&next, i)
+				expanded = append(expanded, next)
+			}
+		}
+		scenarios = expanded
+	}
+
+	expand(len(spec.Topologies), func(sc *Scenario, i int) { sc.Edges = spec.Topologies[i] })
+	expand(len(spec.ChannelTypes), func(sc *Scenario, i int) { sc.ChannelType = spec.ChannelTypes[i] })
+	expand(len(spec.Intervals), func(sc *Scenario, i int) { sc.SendInterval = spec.Intervals[i] })
+	expand(len(spec.Jitters), func(sc *Scenario, i int) { sc.Jitter = spec.Jitters[i] })
+	expand(len(spec.Sends), func(sc *Scenario, i int) { sc.Sends = spec.Sends[i] })
+	expand(len(spec.Direct), func(sc *Scenario, i int) { sc.Direct = spec.Direct[i] })
+	expand(len(spec.HubSets), func(sc *Scenario, i int) { sc.Hubs = spec.HubSets[i] })
+	expand(len(spec.Seeds), func(sc *Scenario, i int) { sc.Seed = spec.Seeds[i] })
+
+	return scenarios
+}
+
+// Result of a single run of a sweep
+type result struct {
+	Scenario Scenario
+	State    *simulator.State // only kept if asked for
+	Sends    []Send           // only kept if asked for
+	Metrics  []simulator.Metric
+	Err      error
+}
+
+// runAll runs the scenarios on up to parallel workers. Results are returned
+// in the same order as the scenarios. The state and sends of each run are
+// only kept if keep is set, so that a sweep does not hold every run's
+// packets until it ends.
+func runAll(scenarios []Scenario, parallel int, keep bool) []result {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]result, len(scenarios))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sc := scenarios[i]
+				results[i].Scenario = sc
+				run, err := runScenario(&sc)
+				if err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Metrics = simulator.Summarize(run.State(), sc.LoadThreshold)
+				if keep {
+					results[i].State = run.State()
+					results[i].Sends = run.Sends
+				}
+			}
+		}()
+	}
+
+	for i := range scenarios {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// replicate returns n copies of the scenario with consecutive seeds,
+// starting at the scenario's seed.
+func replicate(sc Scenario, n int) []Scenario {
+	scenarios := make([]Scenario, n)
+	for i := range scenarios {
+		scenarios[i] = sc
+		scenarios[i].Seed = sc.Seed + int64(i)
+	}
+	return scenarios
+}
+
+// summarizeReplicates summarizes the metrics of replicated runs. Returns the
+// first error if any run failed.
+func summarizeReplicates(results []result) ([]simulator.MetricStats, error) {
+	runs := make([][]simulator.Metric, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		runs = append(runs, r.Metrics)
+	}
+	return simulator.SummarizeReplicates(runs), nil
+}
+
+// The parameters that identify a scenario in a results table
+func scenarioColumns() []string {
+	return []string{"topology", "channel_type", "interval", "jitter", "sends", "direct", "hubs", "seed"}
+}
+
+func scenarioRow(sc *Scenario) []string {
+	return []string{
+		sc.Edges,
+		sc.ChannelType,
+		strconv.FormatInt(sc.SendInterval, 10),
+		strconv.FormatInt(sc.Jitter, 10),
+		strconv.FormatInt(sc.Sends, 10),
+		strconv.FormatBool(sc.Direct),
+		strings.Join(sc.Hubs, " "),
+		strconv.FormatInt(sc.Seed, 10),
+	}
+}
+
+// Writes one row per run with the scenario's parameters followed by its metrics.
+// Runs that failed leave the metrics empty and give the error.
+func writeResults(w io.Writer, results []result) error {
+	var metric_names []string
+	for _, r := range results {
+		if r.Err == nil {
+			for _, m := range r.Metrics {
+				metric_names = append(metric_names, m.Name)
+			}
+			break
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	header := append(scenarioColumns(), metric_names...)
+	if err := writer.Write(append(header, "error")); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		row := scenarioRow(&r.Scenario)
+		if r.Err != nil {
+			row = append(row, make([]string, len(metric_names))...)
+			row = append(row, r.Err.Error())
+		} else {
+			for _, m := range r.Metrics {
+				row = append(row, strconv.FormatFloat(m.Value, 'g', 8, 64))
+			}
+			row = append(row, "")
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes one row per group of n replicated runs with the parameters of the
+// group's first run followed by the mean, standard deviation and 95% confidence
+// interval of every metric.
+func writeReplicatedResults(w io.Writer, results []result, n int) error {
+	var metric_names []string
+	for _, r := range results {
+		if r.Err == nil {
+			for _, m := range r.Metrics {
+				metric_names = append(metric_names, m.Name)
+			}
+			break
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	header := append(scenarioColumns(), "replicates")
+	for _, name := range metric_names {
+		header = append(header, name+"_mean", name+"_sd", name+"_ci_low", name+"_ci_high")
+	}
+	if err := writer.Write(append(header, "error")); err != nil {
+		return err
+	}
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', 8, 64)
+	}
+
+	for i := 0; i < len(results); i += n {
+		group := results[i : i+n]
+		row := append(scenarioRow(&group[0].Scenario), strconv.Itoa(n))
+
+		stats, err := summarizeReplicates(group)
+		if err != nil {
+			row = append(row, make([]string, 4*len(metric_names))...)
+			row = append(row, err.Error())
+		} else {
+			for _, st := range stats {
+				row = append(row, format(st.Mean), format(st.SD), format(st.CILow), format(st.CIHigh))
+			}
+			row = append(row, "")
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// runExperiment runs every combination of a sweep and writes the results table.
+func runExperiment(args []string) {
+	fs := flag.NewFlagSet("experiment", flag.ExitOnError)
+	sc := defaultScenario()
+	bindScenarioFlags(fs, &sc)
+	parallel := fs.Int("parallel", runtime.NumCPU(), "number of runs at the same time")
+	out := fs.String("out", "", "csv file to write the results table to. Defaults to stdout")
+	replicates := fs.Int("replicates", 1, "runs of every combination with consecutive seeds, summarized by their mean, standard deviation and 95% confidence interval")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Printf("Format: main.go experiment [options] [sweep json file]\nOptions:\n")
+		fs.PrintDefaults()
+		return
+	}
+
+	spec, err := readSweepSpec(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	if *replicates < 1 {
+		fmt.Printf("replicates must be at least 1\n")
+		return
+	}
+
+	sc.Quiet = true
+	scenarios := spec.Expand(sc)
+	if *replicates > 1 {
+		replicated := make([]Scenario, 0, len(scenarios)**replicates)
+		for _, base := range scenarios {
+			replicated = append(replicated, replicate(base, *replicates)...)
+		}
+		scenarios = replicated
+	}
+	fmt.Fprintf(os.Stderr, "Running %d scenarios on %d workers\n", len(scenarios), *parallel)
+	results := runAll(scenarios, *parallel, false)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *replicates > 1 {
+		err = writeReplicatedResults(w, results, *replicates)
+	} else {
+		err = writeResults(w, results)
+	}
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Colours of the series in charts
+var seriesColours = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf",
+}
+
+// Size of every chart in pixels
+const (
+	chartWidth  = 640
+	chartHeight = 320
+	chartMargin = 48
+)
+
+// A line in a chart
+type series struct {
+	Name string
+	X    []float64
+	Y    []float64
+}
+
+// Colour for a load from 0 (green) to 1 (red)
+func heatColour(frac float64) string {
+	return fmt.Sprintf("hsl(%d, 70%%, 45%%)", int(math.Round(120*(1-frac))))
+}
+
+// Rounds a range up to a number that reads well on an axis
+func niceMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	step := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*step >= v {
+			return m * step
+		}
+	}
+	return 10 * step
+}
+
+// Writes the legend of a chart. Clicking a name hides or shows its series.
+func writeLegend(b *strings.Builder, chart string, names []string) {
+	b.WriteString(`<div class="legend">`)
+	for i, name := range names {
+		fmt.Fprintf(b, `<span class="item" data-chart="%s" data-series="%d"><i style="background:%s"></i>%s</span>`,
+			chart, i, seriesColours[i%len(seriesColours)], html.EscapeString(name))
+	}
+	b.WriteString("</div>\n")
+}
+
+// Writes a line chart as svg
+func writeLineChart(b *strings.Builder, chart string, x_label string, y_label string, lines []series) {
+	max_x, max_y := 0.0, 0.0
+	for _, s := range lines {
+		for i := range s.X {
+			max_x = math.Max(max_x, s.X[i])
+			max_y = math.Max(max_y, s.Y[i])
+		}
+	}
+	max_x = niceMax(max_x)
+	max_y = niceMax(max_y)
+
+	plot_w := float64(chartWidth - 2*chartMargin)
+	plot_h := float64(chartHeight - 2*chartMargin)
+	px := func(x float64) float64 { return chartMargin + x/max_x*plot_w }
+	py := func(y float64) float64 { return chartHeight - chartMargin - y/max_y*plot_h }
+
+	fmt.Fprintf(b, `<svg id="%s" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", chart, chartWidth, chartHeight, chartWidth, chartHeight)
+
+	// Axes and ticks
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`+"\n", chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`+"\n", chartMargin, chartMargin, chartMargin, chartHeight-chartMargin)
+	for i := 0; i <= 5; i++ {
+		xv := max_x * float64(i) / 5
+		yv := max_y * float64(i) / 5
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" class="tick" text-anchor="middle">%s</text>`+"\n", px(xv), chartHeight-chartMargin+16, formatValue(xv))
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" class="tick" text-anchor="end">%s</text>`+"\n", chartMargin-6, py(yv)+4, formatValue(yv))
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`+"\n", chartMargin, py(yv), chartWidth-chartMargin, py(yv))
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d" class="label" text-anchor="middle">%s</text>`+"\n", chartWidth/2, chartHeight-8, html.EscapeString(x_label))
+	fmt.Fprintf(b, `<text x="14" y="%d" class="label" text-anchor="middle" transform="rotate(-90 14 %d)">%s</text>`+"\n", chartHeight/2, chartHeight/2, html.EscapeString(y_label))
+
+	for i, s := range lines {
+		points := make([]string, len(s.X))
+		for j := range s.X {
+			points[j] = fmt.Sprintf("%.1f,%.1f", px(s.X[j]), py(s.Y[j]))
+		}
+		fmt.Fprintf(b, `<polyline class="series series-%d" points="%s" stroke="%s"><title>%s</title></polyline>`+"\n",
+			i, strings.Join(points, " "), seriesColours[i%len(seriesColours)], html.EscapeString(s.Name))
+	}
+	b.WriteString("</svg>\n")
+
+	names := make([]string, len(lines))
+	for i, s := range lines {
+		names[i] = s.Name
+	}
+	writeLegend(b, chart, names)
+}
+
+// Writes the network with every chain coloured by its most transactions in a block.
+// Hub chains have a thick outline.
+func writeTopology(b *strings.Builder, state *simulator.State, hubs []string) {
+	chain_ids := make([]string, 0, len(state.Chains))
+	max_tx := 0
+	for _, id := range state.ChainIDs() {
+		if ch, ok := state.Chains[id]; ok {
+			chain_ids = append(chain_ids, id)
+			if ch.GetMaxTxCount() > max_tx {
+				max_tx = ch.GetMaxTxCount()
+			}
+		}
+	}
+
+	is_hub := make(map[string]bool)
+	for _, h := range hubs {
+		is_hub[h] = true
+	}
+
+	// Place the chains on a circle. Nodes shrink and the circle grows with
+	// the number of chains, so that nodes do not overlap. Names are written
+	// outwards from the circle.
+	node_r := 18.0
+	if len(chain_ids) > 24 {
+		node_r = math.Max(6, 18*24/float64(len(chain_ids)))
+	}
+	radius := math.Max(200, float64(len(chain_ids))*(2*node_r+6)/(2*math.Pi))
+	const label_width = 80
+	size := int(math.Ceil(2 * (radius + node_r + label_width)))
+	center := float64(size) / 2
+	pos := make(map[string][2]float64)
+	angles := make(map[string]float64)
+	for i, id := range chain_ids {
+		angle := 2*math.Pi*float64(i)/float64(len(chain_ids)) - math.Pi/2
+		pos[id] = [2]float64{center + radius*math.Cos(angle), center + radius*math.Sin(angle)}
+		angles[id] = angle
+	}
+
+	fmt.Fprintf(b, `<svg width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", size, size, size, size)
+	for _, id := range chain_ids {
+		neighbours := make([]string, 0)
+		for n := range state.Chains[id].GetNeighbours() {
+			if n > id {
+				neighbours = append(neighbours, n)
+			}
+		}
+		sort.Strings(neighbours)
+		for _, n := range neighbours {
+			fmt.Fprintf(b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="edge"/>`+"\n", pos[id][0], pos[id][1], pos[n][0], pos[n][1])
+		}
+	}
+
+	for _, id := range chain_ids {
+		ch := state.Chains[id]
+		frac := 0.0
+		if max_tx > 0 {
+			frac = float64(ch.GetMaxTxCount()) / float64(max_tx)
+		}
+		stroke := 1
+		if is_hub[id] {
+			stroke = 4
+		}
+		fmt.Fprintf(b, `<g><title>%s: max %d tx per block, total %d</title><circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s" stroke="#222" stroke-width="%d"/>`,
+			html.EscapeString(id), ch.GetMaxTxCount(), ch.TotalTx(), pos[id][0], pos[id][1], node_r, heatColour(frac), stroke)
+
+		// Names on the left of the circle are turned around to read left to right
+		angle := angles[id]
+		x := center + (radius+node_r+4)*math.Cos(angle)
+		y := center + (radius+node_r+4)*math.Sin(angle)
+		rotate, anchor := angle*180/math.Pi, "start"
+		if math.Cos(angle) < -1e-9 {
+			rotate, anchor = rotate+180, "end"
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" class="node" text-anchor="%s" dominant-baseline="middle" transform="rotate(%.1f %.1f %.1f)">%s</text></g>`+"\n",
+			x, y, anchor, rotate, x, y, html.EscapeString(id))
+	}
+	b.WriteString("</svg>\n")
+}
+
+// Writes a bar per chain with its total transactions, coloured by its most transactions in a block
+func writeLoadBars(b *strings.Builder, state *simulator.State) {
+	chain_ids := make([]string, 0, len(state.Chains))
+	max_total, max_tx := 0, 0
+	for _, id := range state.ChainIDs() {
+		if ch, ok := state.Chains[id]; ok {
+			chain_ids = append(chain_ids, id)
+			if ch.TotalTx() > max_total {
+				max_total = ch.TotalTx()
+			}
+			if ch.GetMaxTxCount() > max_tx {
+				max_tx = ch.GetMaxTxCount()
+			}
+		}
+	}
+
+	const bar_height = 22
+	const label_width = 120
+	height := len(chain_ids)*bar_height + 10
+	fmt.Fprintf(b, `<svg width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", chartWidth, height, chartWidth, height)
+	for i, id := range chain_ids {
+		ch := state.Chains[id]
+		width, frac := 0.0, 0.0
+		if max_total > 0 {
+			width = float64(ch.TotalTx()) / float64(max_total) * float64(chartWidth-label_width-80)
+		}
+		if max_tx > 0 {
+			frac = float64(ch.GetMaxTxCount()) / float64(max_tx)
+		}
+		y := i*bar_height + 5
+		fmt.Fprintf(b, `<text x="%d" y="%d" class="tick" text-anchor="end">%s</text>`, label_width-8, y+15, html.EscapeString(id))
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"><title>max %d tx per block</title></rect>`,
+			label_width, y, width, bar_height-4, heatColour(frac), ch.GetMaxTxCount())
+		fmt.Fprintf(b, `<text x="%.1f" y="%d" class="tick">%d tx | max %d</text>`+"\n", float64(label_width)+width+6, y+15, ch.TotalTx(), ch.GetMaxTxCount())
+	}
+	b.WriteString("</svg>\n")
+}
+
+// Most lines in the latency chart. Beyond this, the chains with the fewest
+// packets delivered are drawn as one line.
+const maxLatencySeries = 10
+
+// Cumulative distribution of the latencies of packets delivered to each chain, and of all packets
+func latencyCDFs(state *simulator.State) []series {
+	by_dst := state.LatenciesByDst()
+
+	cdf := func(name string, d simulator.LatencyDist) series {
+		latencies, counts := d.Values()
+		total := d.Count()
+		s := series{Name: name}
+		delivered := 0
+		for i, l := range latencies {
+			delivered += counts[i]
+			s.X = append(s.X, l)
+			s.Y = append(s.Y, float64(delivered)/float64(total))
+		}
+		return s
+	}
+
+	dsts := make([]string, 0, len(by_dst))
+	for _, id := range state.ChainIDs() {
+		if _, ok := by_dst[id]; ok {
+			dsts = append(dsts, id)
+		}
+	}
+
+	// Keep the chains with the most packets and put the others together
+	others := make(simulator.LatencyDist)
+	if len(dsts) > maxLatencySeries-1 {
+		sort.SliceStable(dsts, func(i, j int) bool {
+			return by_dst[dsts[i]].Count() > by_dst[dsts[j]].Count()
+		})
+		for _, id := range dsts[maxLatencySeries-2:] {
+			others.Merge(by_dst[id])
+		}
+		dsts = dsts[:maxLatencySeries-2]
+	}
+
+	all := make(simulator.LatencyDist)
+	for _, d := range by_dst {
+		all.Merge(d)
+	}
+
+	lines := []series{cdf("all", all)}
+	for _, id := range dsts {
+		lines = append(lines, cdf(id, by_dst[id]))
+	}
+	if len(others) > 0 {
+		lines = append(lines, cdf("other chains", others))
+	}
+	return lines
+}
+
+// Transactions in every recorded block of each chain over time
+func blockSeries(state *simulator.State) []series {
+	by_chain := make(map[string]*series)
+	lines := make([]series, 0)
+	for _, id := range state.ChainIDs() {
+		by_chain[id] = &series{Name: id}
+	}
+	for _, rec := range state.Recorder.Records {
+		s, ok := by_chain[rec.Chain]
+		if !ok {
+			continue
+		}
+		s.X = append(s.X, float64(rec.Offset)/float64(time.Second))
+		s.Y = append(s.Y, float64(rec.Txs))
+	}
+	for _, id := range state.ChainIDs() {
+		if len(by_chain[id].X) > 0 {
+			lines = append(lines, *by_chain[id])
+		}
+	}
+	return lines
+}
+
+const reportStyle = `body { font-family: sans-serif; margin: 24px; color: #222; }
+h2 { margin-top: 32px; }
+.axis { stroke: #222; }
+.grid { stroke: #ddd; }
+.edge { stroke: #999; stroke-width: 2; }
+.series { fill: none; stroke-width: 1.5; }
+.tick, .node { font-size: 11px; }
+.label { font-size: 12px; }
+.legend .item { display: inline-block; margin-right: 12px; cursor: pointer; font-size: 12px; }
+.legend .item i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+.legend .item.off { opacity: 0.3; }
+table { border-collapse: collapse; }
+td { padding: 2px 12px 2px 0; font-size: 13px; }
+`
+
+const reportScript = `document.querySelectorAll(".legend .item").forEach(function (item) {
+	item.addEventListener("click", function () {
+		item.classList.toggle("off");
+		var chart = document.getElementById(item.dataset.chart);
+		chart.querySelectorAll(".series-" + item.dataset.series).forEach(function (line) {
+			line.style.display = item.classList.contains("off") ? "none" : "";
+		});
+	});
+});
+`
+
+// writeHTMLReport writes a self-contained html page with charts of a run.
+// The run must have recorded its blocks.
+func writeHTMLReport(w io.Writer, sc *Scenario, state *simulator.State) error {
+	b := &strings.Builder{}
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Baton Simulator Report</title>\n")
+	fmt.Fprintf(b, "<style>\n%s</style>\n</head>\n<body>\n", reportStyle)
+
+	b.WriteString("<h1>Baton Simulator Report</h1>\n<table>\n")
+	row := func(name string, value string) {
+		fmt.Fprintf(b, "<tr><td>%s</td><td>%s</td></tr>\n", html.EscapeString(name), html.EscapeString(value))
+	}
+	row("topology", sc.Edges)
+	row("channel type", sc.ChannelType)
+	row("send interval", fmt.Sprintf("%dms, jitter %dms", sc.SendInterval, sc.Jitter))
+	row("direct", fmt.Sprintf("%t", sc.Direct))
+	row("hubs", strings.Join(sc.Hubs, " "))
+	row("seed", fmt.Sprintf("%d", sc.Seed))
+	for _, m := range simulator.Summarize(state, sc.LoadThreshold) {
+		row(m.Name, formatValue(m.Value))
+	}
+	b.WriteString("</table>\n")
+
+	b.WriteString("<h2>Topology</h2>\n<p>Chains are coloured by their most transactions in a block. Hubs have a thick outline.</p>\n")
+	writeTopology(b, state, sc.Hubs)
+
+	b.WriteString("<h2>Load per Chain</h2>\n")
+	writeLoadBars(b, state)
+
+	b.WriteString("<h2>Latency</h2>\n<p>Share of packets delivered within a latency, for all packets and by destination chain. Chains with fewer packets are grouped together.</p>\n")
+	writeLineChart(b, "latency", "latency (ms)", "share of packets", latencyCDFs(state))
+
+	b.WriteString("<h2>Transactions per Block</h2>\n")
+	writeLineChart(b, "blocks", "time (s)", "transactions", blockSeries(state))
+
+	fmt.Fprintf(b, "<script>\n%s</script>\n</body>\n</html>\n", reportScript)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Writes the html report of a run to a file
+func writeHTMLFile(filename string, sc *Scenario, state *simulator.State) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeHTMLReport(file, sc, state)
+}
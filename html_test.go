@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNiceMax(t *testing.T) {
+	tests := []struct{ v, want float64 }{
+		{0, 1}, {0.7, 1}, {3, 5}, {12, 20}, {100, 100}, {101, 200}, {999, 1000},
+	}
+	for _, test := range tests {
+		if got := niceMax(test.v); got != test.want {
+			t.Fatalf("axis for %v goes up to %v, want %v", test.v, got, test.want)
+		}
+	}
+}
+
+// The latency lines are cumulative shares of the packets delivered, the
+// first one over all packets
+func TestLatencyCDFs(t *testing.T) {
+	sc := testScenario(writeTestEdges(t))
+	run, err := runScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := latencyCDFs(run.State())
+	if len(lines) < 2 || len(lines) > maxLatencySeries || lines[0].Name != "all" {
+		t.Fatalf("%d latency lines, the first is %s", len(lines), lines[0].Name)
+	}
+	for _, s := range lines {
+		for i := range s.Y {
+			if i > 0 && (s.X[i] <= s.X[i-1] || s.Y[i] < s.Y[i-1]) {
+				t.Fatalf("line %s goes back at point %d", s.Name, i)
+			}
+		}
+		if s.Y[len(s.Y)-1] != 1 {
+			t.Fatalf("line %s ends at %v", s.Name, s.Y[len(s.Y)-1])
+		}
+	}
+}
+
+// The report holds a chart of every kind and needs nothing from elsewhere
+func TestHTMLReport(t *testing.T) {
+	sc := testScenario(writeTestEdges(t))
+	sc.RecordBlocks = true
+	run, err := runScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := writeHTMLReport(&b, &sc, run.State()); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, want := range []string{`<svg id="latency"`, `<svg id="blocks"`, "<h2>Topology</h2>", "<h2>Load per Chain</h2>", "</html>"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("report has no %s", want)
+		}
+	}
+	for _, external := range []string{"http://", "https://", " src="} {
+		if strings.Contains(page, external) {
+			t.Fatalf("report loads %s", external)
+		}
+	}
+}
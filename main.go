@@ -3,11 +3,11 @@ package main
 import (
 	"bufio"
 	"context"
-	"crypto/rand"
 	"errors"
+	"flag"
 	"fmt"
-	"math/big"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +15,11 @@ import (
 	"github.com/SDavidson1177/ThroughputSim/simulator"
 )
 
+// Returns the chain ID for an integer ID from a csv file
+func getChainID(id string) string {
+	return fmt.Sprintf("baton-%s", id)
+}
+
 // Reads in the blockchain topology from edges csv file.
 // The csv file should be structured as follows:
 //
@@ -29,12 +34,9 @@ func readTopology(filename string) (map[string]*simulator.Chain, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	scanner := bufio.NewScanner(file)
 
-	GetChainID := func(id string) string {
-		return fmt.Sprintf("baton-%s", id)
-	}
-
 	chains := make(map[string]*simulator.Chain)
 
 	// Iterate over every edge
@@ -45,223 +47,509 @@ func readTopology(filename string) (map[string]*simulator.Chain, error) {
 		}
 
 		// Add both chains
-		if _, ok := chains[GetChainID(chain_pair[0])]; !ok {
-			chains[GetChainID(chain_pair[0])] = simulator.NewChain(GetChainID(chain_pair[0]))
+		if _, ok := chains[getChainID(chain_pair[0])]; !ok {
+			chains[getChainID(chain_pair[0])] = simulator.NewChain(getChainID(chain_pair[0]))
 		}
 
-		if _, ok := chains[GetChainID(chain_pair[1])]; !ok {
-			chains[GetChainID(chain_pair[1])] = simulator.NewChain(GetChainID(chain_pair[1]))
+		if _, ok := chains[getChainID(chain_pair[1])]; !ok {
+			chains[getChainID(chain_pair[1])] = simulator.NewChain(getChainID(chain_pair[1]))
 		}
 
 		// Make chains neighbours of each other
-		chains[GetChainID(chain_pair[0])].AddNeighbour(chains[GetChainID(chain_pair[1])])
-		chains[GetChainID(chain_pair[1])].AddNeighbour(chains[GetChainID(chain_pair[0])])
+		chains[getChainID(chain_pair[0])].AddNeighbour(chains[getChainID(chain_pair[1])])
+		chains[getChainID(chain_pair[1])].AddNeighbour(chains[getChainID(chain_pair[0])])
 	}
 
 	return chains, nil
 }
 
-// Generates a list of send events
-// If the channel type is 'multi', the event type will be  simulator.SendEvent
-// If the channel type is 'single', the event type will be simulator.SendSingleEvent
-func genSends(ctx context.Context, send_interval uint32, jitter uint32, num_sends int, is_multi_channel bool) ([]simulator.Event, error) {
-	if jitter >= send_interval {
-		return nil, errors.New("jitter cannot be >= than send interval")
-	}
-
-	state, err := simulator.GetStateFromContext(ctx)
+// Reads in the fault injection schedule from a csv file.
+// Each line describes one fault and the window, in milliseconds
+// since the start of the simulation, during which it is active:
+//
+//	halt,1,10000,20000
+//	slow,2,0,30000,2.5
+//	partition,1,2,5000,15000
+//	relayer,2,3,5000,15000
+//
+// 'halt' stops a chain from producing blocks, 'slow' multiplies its
+// block time by the given factor, 'partition' cuts the connection
+// between two chains and 'relayer' takes the connection's relayer offline.
+func readFaults(filename string, chains map[string]*simulator.Chain, start time.Time) ([]*simulator.Fault, error) {
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+
+	parseWindow := func(fields []string) (time.Time, time.Time, error) {
+		s, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return start, start, err
+		}
+		e, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return start, start, err
+		}
+		if e <= s {
+			return start, start, errors.New("fault must end after it starts")
+		}
+		return start.Add(time.Duration(s) * time.Millisecond), start.Add(time.Duration(e) * time.Millisecond), nil
+	}
+
+	getChain := func(id string) (string, error) {
+		if _, ok := chains[getChainID(id)]; !ok {
+			return "", fmt.Errorf("unknown chain %s in fault schedule", id)
+		}
+		return getChainID(id), nil
+	}
+
+	faults := make([]*simulator.Fault, 0)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("not enough fields for fault: %s", scanner.Text())
+		}
 
-	base_time := time.Now()
+		f := &simulator.Fault{Factor: 1}
+		if f.Chain, err = getChain(fields[1]); err != nil {
+			return nil, err
+		}
+
+		switch fields[0] {
+		case "halt":
+			f.Kind = simulator.FAULT_HALT
+			f.Start, f.End, err = parseWindow(fields[2:])
+		case "slow":
+			if len(fields) != 5 {
+				return nil, errors.New("slow fault needs a factor")
+			}
+			f.Kind = simulator.FAULT_SLOW
+			if f.Factor, err = strconv.ParseFloat(fields[4], 64); err == nil && f.Factor < 1 {
+				err = errors.New("slow down factor must be >= 1")
+			}
+			if err == nil {
+				f.Start, f.End, err = parseWindow(fields[2:])
+			}
+		case "partition", "relayer":
+			if len(fields) != 5 {
+				return nil, fmt.Errorf("%s fault needs two chains", fields[0])
+			}
+			f.Kind = simulator.FAULT_PARTITION
+			if fields[0] == "relayer" {
+				f.Kind = simulator.FAULT_RELAYER
+			}
+			if f.Peer, err = getChain(fields[2]); err == nil {
+				f.Start, f.End, err = parseWindow(fields[3:])
+			}
+		default:
+			return nil, fmt.Errorf("unknown fault type %s", fields[0])
+		}
 
-	gen_start_time := func() time.Time {
-		start_r := big.NewInt(int64(send_interval))
-		r, err := rand.Int(rand.Reader, start_r)
 		if err != nil {
-			return base_time
+			return nil, err
 		}
+		faults = append(faults, f)
+	}
+
+	return faults, nil
+}
+
+// Reads in timed changes to the topology from a csv file.
+// Each line gives the change and the time, in milliseconds since
+// the start of the simulation, at which it happens:
+//
+//	add,6,10000
+//	open,6,2,10000
+//	close,2,3,20000
+//	remove,4,30000
+//
+// 'add' adds a chain without any connections, 'open' and 'close'
+// open and close the connection between two chains, and 'remove'
+// removes a chain along with all of its connections.
+func readTopologyChanges(filename string, chains map[string]*simulator.Chain, start time.Time) ([]*simulator.TopologyChange, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
 
-		d, _ := time.ParseDuration(fmt.Sprintf("%dms", r))
-		return base_time.Add(d)
+	// Chains that are added are known from then on
+	known := make(map[string]bool)
+	for id := range chains {
+		known[id] = true
 	}
 
-	gen_send_time := func() time.Time {
-		jitter_r := big.NewInt(int64(jitter))
-		r, err := rand.Int(rand.Reader, jitter_r)
+	getChain := func(id string) (string, error) {
+		if !known[getChainID(id)] {
+			return "", fmt.Errorf("unknown chain %s in topology changes", id)
+		}
+		return getChainID(id), nil
+	}
+
+	parseTime := func(field string) (time.Time, error) {
+		ms, err := strconv.ParseInt(field, 10, 64)
 		if err != nil {
-			return base_time
+			return start, err
 		}
+		return start.Add(time.Duration(ms) * time.Millisecond), nil
+	}
+
+	changes := make([]*simulator.TopologyChange, 0)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		tc := &simulator.TopologyChange{}
 
-		d, _ := time.ParseDuration(fmt.Sprintf("%dms", r.Int64()+int64(send_interval)))
-		return base_time.Add(d)
-	}
-
-	// Create a priority queue for send event timing
-	queue := simulator.NewEventHeap()
-	for c1 := range state.Chains {
-		for c2 := range state.Chains {
-			if c1 != c2 {
-				// Enqueue event
-				queue.Insert(simulator.NewGenSendEvent(
-					gen_start_time(),
-					c1,
-					c2,
-				))
+		switch fields[0] {
+		case "add", "remove":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%s needs a chain and a time", fields[0])
+			}
+			tc.Kind = simulator.TOPOLOGY_REMOVE
+			if fields[0] == "add" {
+				tc.Kind = simulator.TOPOLOGY_ADD
+				known[getChainID(fields[1])] = true
+			}
+			if tc.Chain, err = getChain(fields[1]); err == nil {
+				tc.Time, err = parseTime(fields[2])
+			}
+		case "open", "close":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("%s needs two chains and a time", fields[0])
+			}
+			tc.Kind = simulator.TOPOLOGY_CLOSE
+			if fields[0] == "open" {
+				tc.Kind = simulator.TOPOLOGY_OPEN
 			}
+			if tc.Chain, err = getChain(fields[1]); err == nil {
+				if tc.Peer, err = getChain(fields[2]); err == nil {
+					tc.Time, err = parseTime(fields[3])
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown topology change %s", fields[0])
 		}
+
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, tc)
 	}
 
-	// Get direct and hubs from context
-	direct := ctx.Value(simulator.GetContextKey(simulator.DirectContextKey)).(bool)
-	hub_chains := ctx.Value(simulator.GetContextKey(simulator.HubsContextKey)).(map[string]bool)
+	return changes, nil
+}
 
-	fmt.Printf("Hub chains: %v\n", hub_chains)
+// Parses failure probabilities given as 'out of gas,sequence mismatch,relayer race'
+func parseFailureRates(arg string) (simulator.FailureRates, error) {
+	var rates simulator.FailureRates
+	if arg == "" {
+		return rates, nil
+	}
 
-	// Generate the events
-	hops := make(map[string][]string)
-	retval := make([]simulator.Event, 0)
-	for i := 0; i < num_sends; i++ {
-		next := queue.Pop()
-		if next == nil {
-			return retval, errors.New("queue empty")
+	fields := strings.Split(arg, ",")
+	if len(fields) != simulator.NUM_FAILURES-1 {
+		return rates, fmt.Errorf("expected %d failure probabilities, got %s", simulator.NUM_FAILURES-1, arg)
+	}
+
+	total := 0.0
+	for i, field := range fields {
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || p < 0 {
+			return rates, fmt.Errorf("invalid failure probability %s", field)
 		}
+		rates[i+1] = p
+		total += p
+	}
 
-		gs_evnt := next.(*simulator.GenSendEvent)
-		sp, ok := hops[fmt.Sprintf("%s-%s", gs_evnt.Src, gs_evnt.Dst)]
-		if !ok {
-			spi, err := simulator.GetShortestPath(ctx, gs_evnt.Src, gs_evnt.Dst, hub_chains)
-			if err != nil {
-				// Unreachable. Try another pair.
-				i--
-				continue
+	if total > 1 {
+		return rates, errors.New("failure probabilities add up to more than 1")
+	}
+	return rates, nil
+}
+
+// Reads in the gas used per message type and the gas price of each chain from a csv file.
+// Gas lines give the message type and the gas it uses. Price lines give the chain, its gas
+// price in its native fee token and the value of that token in a common unit:
+//
+//	gas,update,300000
+//	gas,recv,150000
+//	gas,tx,60000
+//	price,1,0.025,0.5
+//	price,default,0.01,1
+//
+// Message types are 'update', 'recv', 'ack' and 'timeout'. 'tx' is the gas used by every
+// transaction on top of its messages. The 'default' price applies to chains without their own price.
+func readGasSchedule(filename string, chains map[string]*simulator.Chain) (*simulator.GasSchedule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+
+	gas := simulator.NewGasSchedule()
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+
+		switch fields[0] {
+		case "gas":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("gas needs a message type and an amount: %s", scanner.Text())
+			}
+			if fields[1] == "tx" {
+				if gas.TxGas, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+					return nil, err
+				}
+				break
 			}
 
-			if !direct {
-				// We are using baton. Therefore, get the Baton shortest path
-				spi, _ = simulator.GetShortestPath(ctx, gs_evnt.Src, gs_evnt.Dst, make(map[string]bool))
+			kind, ok := simulator.MsgKind(fields[1])
+			if !ok {
+				return nil, fmt.Errorf("unknown message type %s", fields[1])
+			}
+			if gas.Gas[kind], err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+				return nil, err
+			}
+		case "price":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("price needs a chain, gas price and unit rate: %s", scanner.Text())
+			}
+			var price simulator.ChainPrice
+			if price.GasPrice, err = strconv.ParseFloat(fields[2], 64); err != nil {
+				return nil, err
+			}
+			if price.UnitRate, err = strconv.ParseFloat(fields[3], 64); err != nil {
+				return nil, err
 			}
-			sp = spi
-			hops[fmt.Sprintf("%s-%s", gs_evnt.Src, gs_evnt.Dst)] = sp
-		}
 
-		var new_event simulator.Event
-
-		if is_multi_channel {
-			new_event = simulator.NewSendEvent(
-				gs_evnt.Time(),
-				sp[0],
-				sp[1:],
-			)
-		} else {
-			new_event = simulator.NewSendSingleEvent(
-				gs_evnt.Time(),
-				sp[0],
-				sp[1:],
-			)
+			if fields[1] == "default" {
+				gas.DefaultPrice = price
+			} else if _, ok := chains[getChainID(fields[1])]; ok {
+				gas.Prices[getChainID(fields[1])] = price
+			} else {
+				return nil, fmt.Errorf("unknown chain %s in gas schedule", fields[1])
+			}
+		default:
+			return nil, fmt.Errorf("unknown gas schedule entry %s", fields[0])
 		}
+	}
 
-		retval = append(retval, new_event)
+	return gas, nil
+}
+
+// Send is a packet sent from one chain to another. The send time is given
+// as an offset from the start of the run, so that the same sends can be
+// replayed in other runs.
+type Send struct {
+	Offset time.Duration
+	Src    string
+	Dst    string
+}
 
-		base_time = gs_evnt.Time()
-		gs_evnt.AdjustTime(gen_send_time())
-		queue.Insert(gs_evnt)
+// Generates a list of sends
+func genSends(ctx context.Context, send_interval uint32, jitter uint32, num_sends int, seed int64) ([]Send, error) {
+	a, err := newArrivals(ctx, send_interval, jitter, num_sends, seed)
+	if err != nil {
+		return nil, err
 	}
+	logHubs(ctx, a.state)
 
-	return retval, nil
+	// Generate the sends
+	retval := make([]Send, 0)
+	for {
+		send, ok, err := a.next()
+		if err != nil {
+			return retval, err
+		}
+		if !ok {
+			return retval, nil
+		}
+		retval = append(retval, send)
+	}
 }
 
-func main() {
-	args := os.Args
-	if len(args) < 4 {
-		fmt.Printf(`Format: main.go [edges csv file] [channel_type] [send interval] [jitter] [number of sends] [direct] [hubs...]
-		Channel type can be either 'single' or 'multi'
-		'single' will assume single-hop channels, but 'multi' will allow for multi-hop channels
-`)
-		return
+func logHubs(ctx context.Context, state *simulator.State) {
+	// Get hubs from context
+	hub_chains := ctx.Value(simulator.GetContextKey(simulator.HubsContextKey)).(map[string]bool)
+
+	state.Logf("Hub chains: %v\n", hub_chains)
+}
+
+// Creates the send events of a run starting at start
+// If the channel type is 'multi', the event type will be  simulator.SendEvent
+// If the channel type is 'single', the event type will be simulator.SendSingleEvent
+func sendEvents(start time.Time, sends []Send, is_multi_channel bool) []simulator.Event {
+	retval := make([]simulator.Event, 0, len(sends))
+	for _, send := range sends {
+		retval = append(retval, sendEvent(start, send, is_multi_channel))
 	}
+	return retval
+}
 
-	chains, err := readTopology(args[1])
-	if err != nil {
-		fmt.Printf("%s\n", err.Error())
-		return
+func sendEvent(start time.Time, send Send, is_multi_channel bool) simulator.Event {
+	if is_multi_channel {
+		return simulator.NewSendEvent(start.Add(send.Offset), send.Src, send.Dst)
 	}
+	return simulator.NewSendSingleEvent(start.Add(send.Offset), send.Src, send.Dst)
+}
 
-	channel_type := args[2]
-	if channel_type != "multi" && channel_type != "single" {
-		panic("channel type must be 'single' or 'multi'")
+// Sets the scenario from the positional arguments of a run: the edges csv
+// file, channel type, send interval, jitter, number of sends, direct and hubs
+func parseScenarioArgs(args []string, sc *Scenario) error {
+	sc.Edges = args[0]
+	sc.ChannelType = args[1]
+	if sc.ChannelType != "multi" && sc.ChannelType != "single" {
+		return fmt.Errorf("channel type must be 'single' or 'multi'")
 	}
 
-	send_interval, err := strconv.ParseInt(args[3], 10, 64)
+	var err error
+	sc.SendInterval, err = strconv.ParseInt(args[2], 10, 64)
 	if err != nil {
-		panic("send interval not the correct format")
+		return fmt.Errorf("send interval not the correct format")
 	}
-	jitter, err := strconv.ParseInt(args[4], 10, 64)
+	sc.Jitter, err = strconv.ParseInt(args[3], 10, 64)
 	if err != nil {
-		panic("jitter not the correct format")
+		return fmt.Errorf("jitter not the correct format")
 	}
-	number_of_sends, err := strconv.ParseInt(args[5], 10, 64)
+	sc.Sends, err = strconv.ParseInt(args[4], 10, 64)
 	if err != nil {
-		panic("'number of sends' not the correct format")
+		return fmt.Errorf("'number of sends' not the correct format")
 	}
 
-	ctx := context.Background()
-
-	main_event := simulator.NewQueue()
-	ctx = context.WithValue(ctx, simulator.GetContextKey(simulator.StateContextKey), main_event.BatonState)
+	if len(args) > 5 && args[5] == "true" {
+		sc.Direct = true
+	}
 
-	direct := false
-	if len(args) >= 6 && args[6] == "true" {
-		direct = true
+	if len(args) > 6 {
+		sc.Hubs = args[6:]
 	}
+	return nil
+}
 
-	ctx = context.WithValue(ctx, simulator.GetContextKey(simulator.DirectContextKey), direct)
+// Prints the commands and the options of a run
+func printUsage() {
+	fmt.Printf(`Format: main.go [options] [edges csv file] [channel_type] [send interval] [jitter] [number of sends] [direct] [hubs...]
+		Channel type can be either 'single' or 'multi'
+		'single' will assume single-hop channels, but 'multi' will allow for multi-hop channels
+       main.go experiment [options] [sweep json file]
+		Runs every combination of the sweep and writes one results table
+       main.go compare [options] [edges csv file] [send interval] [jitter] [number of sends] [hubs...]
+		Runs the same sends with multi-hop Baton, single-hop channels and hub routing
+       main.go resume [options] [checkpoint file]
+		Resumes a run from a checkpoint
+       main.go debug [options] [edges csv file] [channel_type] [send interval] [jitter] [number of sends] [direct] [hubs...]
+		Steps through a run interactively
+       main.go serve [-addr host:port]
+		Serves an HTTP/JSON API to set up, drive and observe runs
+       main.go bench [options] [edges csv file]
+		Benchmarks the event queues, and a scenario over the edges if given
+Options:
+`)
+	flag.PrintDefaults()
+}
 
-	hub_chains := make(map[string]bool)
-	if len(args) >= 7 {
-		for _, c := range args[7:] {
-			hub_chains[c] = true
-		}
+// Runs the events of a run while tracing and playing it back. Returns true
+// if the run stopped at a checkpoint.
+func executeRun(run *Run, cp *CheckpointOptions, trace *TraceOptions, playback *PlaybackOptions) bool {
+	stop_trace, err := trace.start(run)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return true
 	}
-	ctx = context.WithValue(ctx, simulator.GetContextKey(simulator.HubsContextKey), hub_chains)
-
-	// Add blockchains
-	for _, chain := range chains {
-		main_event.BatonState.AddChain(chain)
+	stop_playback, err := playback.start(run)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return true
 	}
-	main_event.Init()
 
-	sends, err := genSends(ctx, uint32(send_interval), uint32(jitter), int(number_of_sends), channel_type == "multi")
-	if err != nil {
+	paused := cp.run(run)
+	if err := stop_playback(); err != nil {
+		fmt.Printf("%s\n", err.Error())
+	}
+	if err := stop_trace(); err != nil {
 		fmt.Printf("%s\n", err.Error())
-		return
 	}
+	return paused
+}
 
-	// Add events
-	for _, e := range sends {
-		simulator.AddEventToLoad(e)
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "experiment" {
+		runExperiment(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		runCompare(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "resume" {
+		runResume(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		runDebug(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
 	}
 
-	simulator.LoadEventsIntoQueue()
+	sc := defaultScenario()
+	bindScenarioFlags(flag.CommandLine, &sc)
+	out := &Outputs{}
+	bindOutputFlags(flag.CommandLine, out)
+	cp := &CheckpointOptions{}
+	bindCheckpointFlags(flag.CommandLine, cp)
+	trace := &TraceOptions{}
+	bindTraceFlags(flag.CommandLine, trace)
+	playback := &PlaybackOptions{}
+	bindPlaybackFlags(flag.CommandLine, playback)
+	replicates := flag.Int("replicates", 1, "runs of the scenario with consecutive seeds, summarized by their mean, standard deviation and 95% confidence interval")
+	flag.Parse()
+
+	args := append([]string{os.Args[0]}, flag.Args()...)
+	if len(args) < 6 {
+		printUsage()
+		return
+	}
 
-	for main_event.Step(ctx) == nil {
+	if err := parseScenarioArgs(args[1:], &sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		printUsage()
+		return
+	}
+	if err := out.configure(&sc); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		printUsage()
+		return
 	}
 
-	// Get all the max tx counts for each chain.
-	// This indicates congestion
-	max_congestion := 0
-	max_con_chain := ""
-	all_tx := 0
-	for _, chain := range main_event.BatonState.Chains {
-		fmt.Printf("Congestion: %s -- %d| total %d\n", chain.GetID(), chain.GetMaxTxCount(), chain.TotalTx())
-		all_tx += chain.TotalTx()
-		if chain.GetMaxTxCount() > max_congestion {
-			max_con_chain = chain.GetID()
-			max_congestion = chain.GetMaxTxCount()
+	if *replicates > 1 {
+		sc.Quiet = true
+		results := runAll(replicate(sc, *replicates), runtime.NumCPU(), false)
+		stats, err := summarizeReplicates(results)
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return
 		}
+		printReplicates(&sc, stats)
+		return
 	}
 
-	fmt.Printf("MOST congestion chain: %s -- %d\n", max_con_chain, max_congestion)
-	fmt.Printf("Total Transactions: %d\n", all_tx)
+	run, err := setupScenario(&sc)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
+
+	if executeRun(run, cp, trace, playback) {
+		return
+	}
+	out.report(run)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// Outputs selects the reports and files produced at the end of a run.
+type Outputs struct {
+	Histograms   bool
+	Costs        bool
+	Blocks       string
+	BlocksFormat string
+	HTML         string
+	DOT          string
+	Edges        bool
+	Routes       bool
+	RoutesCSV    string
+}
+
+// Binds the outputs to command line flags.
+func bindOutputFlags(fs *flag.FlagSet, o *Outputs) {
+	fs.BoolVar(&o.Histograms, "histograms", false, "print the histogram of transactions per block of every chain")
+	fs.BoolVar(&o.Costs, "costs", false, "print the fees paid per chain and per relayer")
+	fs.StringVar(&o.Blocks, "blocks", "", "file to write the transactions included in every block to")
+	fs.StringVar(&o.BlocksFormat, "blocks-format", "csv", "'csv' writes one row per block, 'column-files' writes a directory with one csv file per column")
+	fs.StringVar(&o.HTML, "html", "", "file to write an html report with charts of the run to")
+	fs.StringVar(&o.DOT, "dot", "", "file to write the chain graph annotated with the run's load to, in Graphviz DOT format")
+	fs.BoolVar(&o.Edges, "edges", false, "print the client updates and packets carried by every connection")
+	fs.BoolVar(&o.Routes, "routes", false, "print the hop counts, hub crossings and stretch of the routes used, and the unreachable pairs")
+	fs.StringVar(&o.RoutesCSV, "routes-csv", "", "file to write every route used and every unreachable pair to")
+}
+
+// Turns on what the outputs need to be recorded during the run
+func (o *Outputs) configure(sc *Scenario) error {
+	if o.Blocks != "" {
+		if o.BlocksFormat != "csv" && o.BlocksFormat != "column-files" {
+			return errors.New("blocks format must be 'csv' or 'column-files'")
+		}
+		sc.RecordBlocks = true
+	}
+	if o.HTML != "" {
+		sc.RecordBlocks = true
+	}
+	return nil
+}
+
+// Prints the reports and writes the files of a finished run
+func (o *Outputs) report(run *Run) {
+	sc := run.Scenario
+	state := run.State()
+
+	printCongestion(state)
+	printBreakdown(state)
+	printLoad(state, sc.LoadThreshold, o.Histograms)
+
+	if state.Batching != nil {
+		printBatching(state)
+	}
+
+	printLatency(state, run.Faults)
+
+	if state.Failures != nil {
+		printFailures(state)
+	}
+
+	if o.Edges {
+		printEdges(state)
+	}
+
+	if o.Routes {
+		printRoutes(state, sc.Hubs)
+	}
+
+	if o.RoutesCSV != "" {
+		if err := writeRoutes(state, o.RoutesCSV); err != nil {
+			fmt.Printf("%s\n", err.Error())
+		}
+	}
+
+	if o.Costs || sc.Gas != "" {
+		printCosts(state)
+	}
+
+	if o.Blocks != "" {
+		if err := writeBlocks(state.Recorder, o.Blocks, o.BlocksFormat); err != nil {
+			fmt.Printf("%s\n", err.Error())
+		}
+	}
+
+	if o.HTML != "" {
+		if err := writeHTMLFile(o.HTML, sc, state); err != nil {
+			fmt.Printf("%s\n", err.Error())
+		}
+	}
+
+	if o.DOT != "" {
+		if err := writeDOTFile(o.DOT, state, sc.Hubs); err != nil {
+			fmt.Printf("%s\n", err.Error())
+		}
+	}
+
+	if len(run.Changes) > 0 {
+		t := state.Topology
+		fmt.Printf("Topology changes: %d | rerouted packets: %d | unroutable sends: %d | lost packets: %d\n",
+			t.Changes, t.Rerouted, t.Unroutable, t.Lost)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// PlaybackOptions paces a run to the wall clock and writes frames of it as it plays.
+type PlaybackOptions struct {
+	Speed  float64
+	Frames string
+	Every  int64 // milliseconds of simulated time between frames
+}
+
+func bindPlaybackFlags(fs *flag.FlagSet, p *PlaybackOptions) {
+	fs.Float64Var(&p.Speed, "speed", 0, "play the run in real time, sped up by this factor. 0 runs as fast as possible")
+	fs.StringVar(&p.Frames, "frames", "", "file to write frames of the run to as JSON lines, or '-' for stdout")
+	fs.Int64Var(&p.Every, "frame-every", 1000, "milliseconds of simulated time between frames")
+}
+
+// Holds every event back until it is due and writes the frames that are due before it
+type playbackObserver struct {
+	simulator.BaseObserver
+	pacer *simulator.Pacer
+	every time.Duration
+	next  time.Time
+	enc   *json.Encoder
+}
+
+func (o *playbackObserver) BeforeEvent(sim *simulator.Sim, e simulator.Event) {
+	if o.enc != nil {
+		for !o.next.After(e.Time()) {
+			o.pacer.Wait(o.next, nil)
+			o.enc.Encode(sim.State().Frame(o.next))
+			o.next = o.next.Add(o.every)
+		}
+	}
+	o.pacer.Wait(e.Time(), nil)
+}
+
+// start paces the run and writes its frames. The returned function writes
+// the last frame once the run is over.
+func (p *PlaybackOptions) start(run *Run) (func() error, error) {
+	if p.Speed <= 0 && p.Frames == "" {
+		return func() error { return nil }, nil
+	}
+	if p.Every <= 0 {
+		p.Every = 1000
+	}
+
+	state := run.State()
+	o := &playbackObserver{
+		pacer: simulator.NewPacer(p.Speed),
+		every: time.Duration(p.Every) * time.Millisecond,
+		next:  state.Start,
+	}
+	// A resumed run carries on from its checkpoint
+	for o.next.Before(state.Time) {
+		o.next = o.next.Add(o.every)
+	}
+
+	var w io.WriteCloser
+	switch p.Frames {
+	case "":
+	case "-":
+		o.enc = json.NewEncoder(os.Stdout)
+	default:
+		file, err := os.Create(p.Frames)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+		o.enc = json.NewEncoder(file)
+	}
+	run.Queue.AddObserver(o)
+
+	return func() error {
+		run.Queue.RemoveObserver(o)
+		if o.enc == nil {
+			return nil
+		}
+		err := o.enc.Encode(state.Frame(state.Time))
+		if w != nil {
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Get all the max tx counts for each chain.
+// This indicates congestion
+func printCongestion(state *simulator.State) {
+	max_congestion := 0
+	max_con_chain := ""
+	all_tx := 0
+	for _, chain := range state.Chains {
+		fmt.Printf("Congestion: %s -- %d| total %d\n", chain.GetID(), chain.GetMaxTxCount(), chain.TotalTx())
+		all_tx += chain.TotalTx()
+		if chain.GetMaxTxCount() > max_congestion {
+			max_con_chain = chain.GetID()
+			max_congestion = chain.GetMaxTxCount()
+		}
+	}
+
+	fmt.Printf("MOST congestion chain: %s -- %d\n", max_con_chain, max_congestion)
+	fmt.Printf("Total Transactions: %d\n", all_tx)
+}
+
+// Writes the recorded blocks to a csv file or to a directory of column files
+func writeBlocks(recorder *simulator.Recorder, out string, format string) error {
+	if format == "column-files" {
+		return recorder.WriteColumnFiles(out)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return recorder.WriteCSV(file)
+}
+
+// Prints the messages included per block next to the transactions carrying them
+func printBatching(state *simulator.State) {
+	all_msgs := 0
+	all_tx := 0
+	for _, chain := range state.Chains {
+		fmt.Printf("Messages: %s -- %d| total %d\n", chain.GetID(), chain.GetMaxMsgCount(), chain.TotalMsgs())
+		all_msgs += chain.TotalMsgs()
+		all_tx += chain.TotalTx()
+	}
+
+	per_tx := 0.0
+	if all_tx > 0 {
+		per_tx = float64(all_msgs) / float64(all_tx)
+	}
+	fmt.Printf("Total Messages: %d | messages per transaction: %.2f\n", all_msgs, per_tx)
+}
+
+// Prints the messages of each type included on each chain, along with the
+// client updates that were skipped since the chain already had the height.
+// Intermediate chains on Baton routes should only see client updates.
+func printBreakdown(state *simulator.State) {
+	totals := make([]int, simulator.NUM_MSGS)
+	all_redundant := 0
+	all_wasted := 0
+	for _, chain := range state.Chains {
+		fmt.Printf("Breakdown: %s --", chain.GetID())
+		for kind := uint32(0); kind < simulator.NUM_MSGS; kind++ {
+			fmt.Printf(" %s %d |", simulator.MsgName(kind), chain.TotalMsgsOf(kind))
+			totals[kind] += chain.TotalMsgsOf(kind)
+		}
+		fmt.Printf(" redundant %d | wasted %d\n", chain.RedundantUpdates(), chain.WastedTx())
+		all_redundant += chain.RedundantUpdates()
+		all_wasted += chain.WastedTx()
+	}
+
+	fmt.Printf("Total Breakdown:")
+	for kind := uint32(0); kind < simulator.NUM_MSGS; kind++ {
+		fmt.Printf(" %s %d |", simulator.MsgName(kind), totals[kind])
+	}
+	fmt.Printf(" redundant %d | wasted %d\n", all_redundant, all_wasted)
+}
+
+// Prints the distribution of transactions per block of each chain, and how
+// concentrated the transactions are across chains. This tells a single spike
+// apart from sustained overload.
+func printLoad(state *simulator.State, threshold int, histograms bool) {
+	totals := make([]float64, 0, len(state.Chains))
+	for _, chain := range state.Chains {
+		l := simulator.SummarizeLoad(chain.BlockLoads(), threshold)
+		fmt.Printf("Load: %s -- blocks %d | mean %.2f | p50 %d | p90 %d | p99 %d | max %d | above %d: %.2f%%\n",
+			chain.GetID(), l.Blocks, l.Mean, l.P50, l.P90, l.P99, l.Max, threshold, l.AboveShare*100)
+		totals = append(totals, float64(chain.TotalTx()))
+
+		if histograms {
+			loads := make([]int, 0, len(chain.BlockLoads()))
+			for load := range chain.BlockLoads() {
+				loads = append(loads, load)
+			}
+			sort.Ints(loads)
+
+			fmt.Printf("Histogram: %s --", chain.GetID())
+			for _, load := range loads {
+				fmt.Printf(" %d:%d", load, chain.BlockLoads()[load])
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	top_share, hhi := simulator.Concentration(totals)
+	fmt.Printf("Load concentration: gini %.3f | top chain share %.3f | hhi %.3f\n", simulator.Gini(totals), top_share, hhi)
+}
+
+// Prints the latency of delivered packets. When faults were injected, packets
+// are split by whether they were sent before, during or after each fault so
+// that degradation and recovery can be compared.
+func printLatency(state *simulator.State, faults []*simulator.Fault) {
+	print := func(label string, l simulator.PacketTally) {
+		fmt.Printf("%s: delivered %d/%d | mean latency %v | max latency %v\n", label, l.Delivered, l.Count, l.Mean(), l.Max)
+	}
+
+	print("Packets", state.TallyPackets(time.Time{}, time.Time{}))
+
+	if len(faults) == 0 {
+		return
+	}
+
+	fmt.Printf("Skipped blocks: %d | deferred updates: %d | deferred deliveries: %d\n",
+		state.Faults.SkippedBlocks, state.Faults.DeferredUpdates, state.Faults.DeferredDeliveries)
+	for _, f := range faults {
+		print(fmt.Sprintf("Fault %s before", f), state.TallyPackets(time.Time{}, f.Start))
+		print(fmt.Sprintf("Fault %s during", f), state.TallyPackets(f.Start, f.End))
+		print(fmt.Sprintf("Fault %s after", f), state.TallyPackets(f.End, time.Time{}))
+	}
+}
+
+// Prints failed submissions by reason and the transactions they wasted on each chain
+func printFailures(state *simulator.State) {
+	stats := state.FailureStats
+	for reason := uint32(1); reason < simulator.NUM_FAILURES; reason++ {
+		fmt.Printf("Failed (%s): %d\n", simulator.FailureName(reason), stats.Failed[reason])
+	}
+	fmt.Printf("Retries: %d | timed out packets: %d\n", stats.Retries, stats.TimedOut)
+
+	all_wasted := 0
+	for _, chain := range state.Chains {
+		fmt.Printf("Wasted: %s -- %d\n", chain.GetID(), chain.WastedTx())
+		all_wasted += chain.WastedTx()
+	}
+	fmt.Printf("Total Wasted Transactions: %d\n", all_wasted)
+}
+
+// Prints the gas used and fees paid on each chain and by each relayer. Fees
+// are given in the common unit so that routing modes can be compared.
+func printCosts(state *simulator.State) {
+	total_gas := uint64(0)
+	total_fees := 0.0
+	for _, chain := range state.Chains {
+		fmt.Printf("Cost: %s -- gas %d | native fees %.4f | fees %.4f\n", chain.GetID(), chain.GasUsed(), chain.NativeFees(), chain.Fees())
+		total_gas += chain.GasUsed()
+		total_fees += chain.Fees()
+	}
+
+	for relayer, cost := range state.RelayerCosts {
+		fmt.Printf("Relayer cost: %s -- msgs %d | gas %d | fees %.4f\n", relayer, cost.Msgs, cost.Gas, cost.Fee)
+	}
+
+	packet_fees, max_fee := state.PacketFees()
+	delivered := state.CountPackets().Delivered
+
+	per_packet := 0.0
+	if delivered > 0 {
+		per_packet = total_fees / float64(delivered)
+	}
+
+	fmt.Printf("Packet fees: %.4f\n", packet_fees)
+	fmt.Printf("Max packet fees: %.4f\n", max_fee)
+	fmt.Printf("Fees per delivered packet: %.4f\n", per_packet)
+	fmt.Printf("Total Gas: %d | Total Fees: %.4f\n", total_gas, total_fees)
+}
+
+// Prints the summary metrics of replicated runs
+func printReplicates(sc *Scenario, stats []simulator.MetricStats) {
+	if len(stats) == 0 {
+		return
+	}
+
+	fmt.Printf("Replicates: %d runs | seeds %d to %d\n", stats[0].N, sc.Seed, sc.Seed+int64(stats[0].N)-1)
+	for _, st := range stats {
+		fmt.Printf("%s -- mean %.3f | sd %.3f | 95%% CI [%.3f, %.3f]\n", st.Name, st.Mean, st.SD, st.CILow, st.CIHigh)
+	}
+}
+
+// Prints the client updates and packets carried by every connection in each
+// direction, followed by the busiest connections
+func printEdges(state *simulator.State) {
+	edges := state.EdgeTable()
+	all := 0
+	for _, e := range edges {
+		fmt.Printf("Edge: %s -- %s | updates %d / %d | packets %d / %d | total %d\n",
+			e.A, e.B, e.AB.Updates, e.BA.Updates, e.AB.Packets, e.BA.Packets, e.Total())
+		all += e.Total()
+	}
+
+	for _, e := range simulator.Bottlenecks(edges, 3) {
+		share := 0.0
+		if all > 0 {
+			share = float64(e.Total()) / float64(all)
+		}
+		fmt.Printf("Bottleneck: %s -- %s | total %d | share %.2f%%\n", e.A, e.B, e.Total(), 100*share)
+	}
+}
+
+// Prints the routes used to send packets: how many hops they take, how many
+// cross each hub, how much longer they are than the shortest path ignoring
+// hubs, and the pairs that could not reach each other
+func printRoutes(state *simulator.State, hubs []string) {
+	routes := state.Routes()
+
+	by_hops := make(map[int][2]int)
+	max_hops := 0
+	stretch, max_stretch := 0.0, 0.0
+	packets := 0
+	for _, r := range routes {
+		n := by_hops[r.HopCount()]
+		by_hops[r.HopCount()] = [2]int{n[0] + 1, n[1] + r.Packets}
+		if r.HopCount() > max_hops {
+			max_hops = r.HopCount()
+		}
+
+		// Weighted by the packets sent over the route
+		stretch += r.Stretch() * float64(r.Packets)
+		packets += r.Packets
+		if r.Stretch() > max_stretch {
+			max_stretch = r.Stretch()
+		}
+	}
+
+	for hops := 1; hops <= max_hops; hops++ {
+		if n, ok := by_hops[hops]; ok {
+			fmt.Printf("Route hops: %d -- routes %d | packets %d\n", hops, n[0], n[1])
+		}
+	}
+
+	for _, hub := range hubs {
+		crossing, hub_packets := 0, 0
+		for _, r := range routes {
+			if r.Crosses(hub) {
+				crossing++
+				hub_packets += r.Packets
+			}
+		}
+		fmt.Printf("Hub routes: %s -- routes %d | packets %d\n", hub, crossing, hub_packets)
+	}
+
+	if packets > 0 {
+		stretch /= float64(packets)
+	}
+	fmt.Printf("Route stretch: mean %.3f | max %.3f\n", stretch, max_stretch)
+
+	for _, p := range state.UnreachablePairs() {
+		fmt.Printf("Unreachable: %s -> %s\n", p.Src, p.Dst)
+	}
+}
+
+// Writes the routes used and the unreachable pairs to a csv file
+func writeRoutes(state *simulator.State, out string) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return state.WriteRoutesCSV(file)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Scenario holds everything needed to run a simulation.
+type Scenario struct {
+	Edges        string
+	ChannelType  string // 'single' or 'multi'
+	SendInterval int64  // milliseconds
+	Jitter       int64  // milliseconds
+	Sends        int64
+	Direct       bool
+	Hubs         []string
+	Seed         int64
+
+	Faults          string // csv file with a fault injection schedule
+	TopologyChanges string // csv file with timed topology changes
+	UpdateFailures  string
+	DeliverFailures string
+	MaxRetries      int
+	RetryDelay      int64 // milliseconds
+	RetryBackoff    float64
+	PacketTimeout   int64 // milliseconds
+	Acks            bool
+	Gas             string // csv file with a gas schedule
+	BatchSize       int
+	BatchWindow     int64 // milliseconds
+	RecordBlocks    bool
+	LoadThreshold   int
+
+	Events string // event list that replaces the generated sends
+	Queue  string // 'heap' or 'calendar'
+	Stream bool   // generate sends as the run goes instead of before it
+
+	Quiet    bool   // do not log events
+	Workload []Send // sends to replay instead of generating them
+}
+
+// Binds the scenario options to command line flags. The flags' defaults
+// are the scenario's current values.
+func bindScenarioFlags(fs *flag.FlagSet, sc *Scenario) {
+	fs.StringVar(&sc.Faults, "faults", sc.Faults, "csv file with a fault injection schedule")
+	fs.StringVar(&sc.TopologyChanges, "topology-changes", sc.TopologyChanges, "csv file with timed topology changes")
+	fs.Int64Var(&sc.Seed, "seed", sc.Seed, "seed for all random choices made during the run")
+	fs.StringVar(&sc.UpdateFailures, "update-failures", sc.UpdateFailures, "probabilities that a client update fails: 'out of gas,sequence mismatch,relayer race'")
+	fs.StringVar(&sc.DeliverFailures, "deliver-failures", sc.DeliverFailures, "probabilities that a delivery fails: 'out of gas,sequence mismatch,relayer race'")
+	fs.IntVar(&sc.MaxRetries, "max-retries", sc.MaxRetries, "failed submissions retried before the packet times out")
+	fs.Int64Var(&sc.RetryDelay, "retry-delay", sc.RetryDelay, "milliseconds before retrying a failed submission")
+	fs.Float64Var(&sc.RetryBackoff, "retry-backoff", sc.RetryBackoff, "multiplier applied to the retry delay after every retry")
+	fs.Int64Var(&sc.PacketTimeout, "packet-timeout", sc.PacketTimeout, "milliseconds after which an undelivered packet times out. 0 for no timeout")
+	fs.BoolVar(&sc.Acks, "acks", sc.Acks, "relay acknowledgements back to the source chain")
+	fs.StringVar(&sc.Gas, "gas", sc.Gas, "csv file with gas used per message type and gas prices per chain")
+	fs.IntVar(&sc.BatchSize, "batch-size", sc.BatchSize, "most messages a relayer bundles into one transaction")
+	fs.Int64Var(&sc.BatchWindow, "batch-window", sc.BatchWindow, "milliseconds a relayer waits for more messages to bundle into a transaction")
+	fs.IntVar(&sc.LoadThreshold, "load-threshold", sc.LoadThreshold, "transactions per block above which a block counts as overloaded")
+	fs.StringVar(&sc.Events, "events", sc.Events, "file with an event list to run instead of generated sends")
+	fs.StringVar(&sc.Queue, "queue", sc.Queue, "how pending events are kept: 'heap' or 'calendar'. Both run events in the same order")
+	fs.BoolVar(&sc.Stream, "stream", sc.Stream, "generate sends as the run reaches them, keeping memory constant in the number of sends")
+	fs.BoolVar(&sc.Quiet, "quiet", sc.Quiet, "do not log every event")
+}
+
+func defaultScenario() Scenario {
+	return Scenario{
+		ChannelType:   "multi",
+		Queue:         "heap",
+		SendInterval:  1000,
+		Jitter:        100,
+		Sends:         1000,
+		Seed:          time.Now().UnixNano(),
+		MaxRetries:    3,
+		RetryDelay:    simulator.IMPLICIT_HEIGHT_INTERVAL,
+		RetryBackoff:  1,
+		BatchSize:     1,
+		LoadThreshold: 10,
+	}
+}
+
+// Run is a simulation set up from a scenario.
+type Run struct {
+	Scenario *Scenario
+	Queue    *simulator.EventQueue
+	Ctx      context.Context
+	Faults   []*simulator.Fault
+	Changes  []*simulator.TopologyChange
+	Sends    []Send
+	Source   *sendSource       // sends generated as the run goes, instead of Sends
+	Loaded   []simulator.Event // events loaded for the scenario, before they run
+}
+
+func (r *Run) State() *simulator.State {
+	return r.Queue.BatonState
+}
+
+// Finish steps through events until the queue is empty.
+func (r *Run) Finish() {
+	for r.Queue.Step(r.Ctx) == nil {
+	}
+}
+
+// Adds an event to the events loaded for the run
+func (r *Run) load(e simulator.Event) {
+	r.Loaded = append(r.Loaded, e)
+	r.Queue.AddEventToLoad(e)
+}
+
+// Creates the context that events of the scenario run in
+func scenarioContext(sc *Scenario, state *simulator.State) context.Context {
+	return simulator.NewContext(state, sc.Direct, sc.Hubs)
+}
+
+// Sets the failure model of the scenario. Submissions never fail if no
+// failure rates or packet timeout are given.
+func configureFailures(state *simulator.State, sc *Scenario) error {
+	state.Failures = nil
+	if sc.UpdateFailures == "" && sc.DeliverFailures == "" && sc.PacketTimeout <= 0 {
+		return nil
+	}
+
+	var err error
+	model := simulator.NewFailureModel()
+	if model.Update, err = parseFailureRates(sc.UpdateFailures); err != nil {
+		return err
+	}
+	if model.Deliver, err = parseFailureRates(sc.DeliverFailures); err != nil {
+		return err
+	}
+	model.MaxRetries = sc.MaxRetries
+	model.RetryDelay = time.Duration(sc.RetryDelay) * time.Millisecond
+	model.Backoff = sc.RetryBackoff
+	model.PacketTimeout = time.Duration(sc.PacketTimeout) * time.Millisecond
+	state.Failures = model
+	return nil
+}
+
+// Sets how relayers batch messages. Every message is its own transaction
+// when the batch size is at most 1.
+func configureBatching(state *simulator.State, sc *Scenario) {
+	state.Batching = nil
+	if sc.BatchSize > 1 {
+		state.Batching = &simulator.BatchModel{
+			MaxSize: sc.BatchSize,
+			Window:  time.Duration(sc.BatchWindow) * time.Millisecond,
+		}
+	}
+}
+
+// setupScenario builds the network and loads every event of the scenario into
+// a queue of its own. Runs that are set up separately do not share any state.
+func setupScenario(sc *Scenario) (*Run, error) {
+	chains, err := readTopology(sc.Edges)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.ChannelType != "multi" && sc.ChannelType != "single" {
+		return nil, errors.New("channel type must be 'single' or 'multi'")
+	}
+
+	run := &Run{Scenario: sc, Queue: simulator.NewEventQueue()}
+	switch sc.Queue {
+	case "", "heap":
+	case "calendar":
+		run.Queue.UseCalendarQueue()
+	default:
+		return nil, errors.New("queue must be 'heap' or 'calendar'")
+	}
+	state := run.Queue.BatonState
+	if sc.Quiet {
+		state.Log = nil
+	}
+
+	ctx := scenarioContext(sc, state)
+	run.Ctx = ctx
+
+	// Configure failures
+	state.Rand = simulator.NewRand(sc.Seed)
+	if err := configureFailures(state, sc); err != nil {
+		return nil, err
+	}
+
+	// Configure fees
+	state.Acks = sc.Acks
+	if sc.Gas != "" {
+		if state.Gas, err = readGasSchedule(sc.Gas, chains); err != nil {
+			return nil, err
+		}
+	}
+
+	// Configure batching
+	configureBatching(state, sc)
+
+	// Record every block
+	if sc.RecordBlocks {
+		state.Recorder = simulator.NewRecorder()
+	}
+
+	// Add blockchains
+	for _, chain := range chains {
+		state.AddChain(chain)
+	}
+
+	// Chains that are added during the run need to be known upfront
+	var changes []*simulator.TopologyChange
+	if sc.TopologyChanges != "" {
+		if changes, err = readTopologyChanges(sc.TopologyChanges, chains, state.Start); err != nil {
+			return nil, err
+		}
+	}
+	run.Changes = changes
+
+	var events []simulator.Event
+	if sc.Events != "" {
+		if events, err = readEvents(sc.Events, state); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range events {
+		switch ev := e.(type) {
+		case *simulator.TopologyEvent:
+			run.Changes = append(run.Changes, ev.Change())
+		case *simulator.FaultEvent:
+			if ev.Active() {
+				run.Faults = append(run.Faults, ev.Fault())
+			}
+		}
+	}
+
+	for _, tc := range run.Changes {
+		if tc.Kind == simulator.TOPOLOGY_ADD {
+			state.ReserveChain(tc.Chain)
+		}
+	}
+	run.Queue.Init()
+
+	// An event list replaces the generated sends
+	if sc.Events == "" {
+		run.Sends = sc.Workload
+		if run.Sends == nil && sc.Stream {
+			a, err := streamArrivals(ctx, uint32(sc.SendInterval), uint32(sc.Jitter), int(sc.Sends), sc.Seed)
+			if err != nil {
+				return nil, err
+			}
+			run.Source = &sendSource{arrivals: a, start: state.Start, multi: sc.ChannelType == "multi"}
+		} else if run.Sends == nil {
+			if run.Sends, err = genSends(ctx, uint32(sc.SendInterval), uint32(sc.Jitter), int(sc.Sends), sc.Seed); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Add events
+	for _, e := range events {
+		run.load(e)
+	}
+	for _, e := range sendEvents(state.Start, run.Sends, sc.ChannelType == "multi") {
+		run.load(e)
+	}
+
+	// Add faults
+	if sc.Faults != "" {
+		faults, err := readFaults(sc.Faults, chains, state.Start)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range faults {
+			run.load(simulator.NewFaultEvent(f.Start, f, true))
+			run.load(simulator.NewFaultEvent(f.End, f, false))
+		}
+		run.Faults = append(run.Faults, faults...)
+	}
+
+	for _, tc := range changes {
+		run.load(simulator.NewTopologyEvent(tc))
+	}
+
+	// Implicit events start from the first send. Only the packets in flight
+	// are kept, with latencies still split by fault.
+	if run.Source != nil {
+		run.Queue.AddSource(run.Source)
+
+		var bounds []time.Time
+		for _, f := range run.Faults {
+			bounds = append(bounds, f.Start, f.End)
+		}
+		state.DropFinished(bounds)
+	}
+
+	run.Queue.LoadEventsIntoQueue()
+	return run, nil
+}
+
+// RunUntil steps through the events that happen before t.
+func (r *Run) RunUntil(t time.Time) {
+	for next := r.Queue.Next(); next != nil && next.Time().Before(t); next = r.Queue.Next() {
+		r.Queue.Step(r.Ctx)
+	}
+}
+
+// runScenario sets up the scenario and runs it to the end.
+func runScenario(sc *Scenario) (*Run, error) {
+	run, err := setupScenario(sc)
+	if err != nil {
+		return nil, err
+	}
+	run.Finish()
+	return run, nil
+}
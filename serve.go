@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+const (
+	RUN_PAUSED   = "paused"
+	RUN_RUNNING  = "running"
+	RUN_FINISHED = "finished"
+)
+
+// Events buffered for each stream. Streams that fall further behind miss events.
+const STREAM_BUFFER = 1024
+
+// message is sent to the streams of a run
+type message struct {
+	kind string // 'event' or 'frame'
+	data []byte
+}
+
+// served is a run driven through the HTTP API. Everything about the run is
+// guarded by mu, so that it can be inspected while it runs.
+type served struct {
+	mu       sync.Mutex
+	id       string
+	run      *Run
+	status   string
+	executed int
+	streams  map[chan message]bool
+	dropped  int // messages that streams missed
+
+	// Playback
+	generation int           // counts the starts, so that only the latest one plays the run
+	cancel     chan struct{} // closed once the latest start stops playing, to end its waits
+	pacer      *simulator.Pacer
+	every      time.Duration // simulated time between frames, 0 for no frames
+	next_frame time.Time
+}
+
+// Sends a message to every stream, dropping it for streams that are behind
+func (s *served) broadcastLocked(kind string, v any) {
+	if len(s.streams) == 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	for ch := range s.streams {
+		select {
+		case ch <- message{kind, data}:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// Streams every event that ran to the subscribers
+type streamObserver struct {
+	simulator.BaseObserver
+	s *served
+}
+
+func (o *streamObserver) AfterEvent(sim *simulator.Sim, e simulator.Event) {
+	o.s.executed++
+	if len(o.s.streams) == 0 {
+		return
+	}
+
+	entry, err := simulator.NewEventEntry(e, sim.Start())
+	if err != nil {
+		return
+	}
+	o.s.broadcastLocked("event", entry)
+}
+
+// Status of a run as returned by the API
+type runStatus struct {
+	ID       string  `json:"id"`
+	Status   string  `json:"status"`
+	TimeMs   float64 `json:"time_ms"`
+	Executed int     `json:"executed"`
+	Pending  int     `json:"pending"`
+	Dropped  int     `json:"dropped"`
+}
+
+func (s *served) statusLocked() runStatus {
+	state := s.run.State()
+	elapsed := 0.0
+	if state.Time.After(state.Start) {
+		elapsed = float64(state.Time.Sub(state.Start)) / float64(time.Millisecond)
+	}
+	return runStatus{
+		ID:       s.id,
+		Status:   s.status,
+		TimeMs:   elapsed,
+		Executed: s.executed,
+		Pending:  s.run.Queue.Len(),
+		Dropped:  s.dropped,
+	}
+}
+
+func (s *served) current() runStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+// Whether the run is still being played by the start of the given generation
+func (s *served) playingLocked(generation int) bool {
+	return s.status == RUN_RUNNING && s.generation == generation
+}
+
+// Ends the waits of the generation that is playing, if any
+func (s *served) stopPlayingLocked() {
+	if s.cancel != nil {
+		close(s.cancel)
+		s.cancel = nil
+	}
+}
+
+// Steps through up to n events, or every event if n is negative. Playing
+// every event stops once the run is paused or started again, as a start
+// gives the run a new generation. Running events are paced and framed if
+// playback was asked for. Must be called without holding mu.
+func (s *served) advance(n int, generation int) {
+	for i := 0; n < 0 || i < n; i++ {
+		s.mu.Lock()
+		if n < 0 && !s.playingLocked(generation) {
+			s.mu.Unlock()
+			return
+		}
+		next := s.run.Queue.Next()
+		if next == nil {
+			s.finishLocked()
+			s.mu.Unlock()
+			return
+		}
+		pacer, cancel := s.pacer, s.cancel
+		s.mu.Unlock()
+
+		// Wait without holding the run, so that it can be inspected meanwhile
+		if n < 0 && pacer != nil && !s.pace(pacer, cancel, generation, next.Time()) {
+			return
+		}
+
+		s.mu.Lock()
+		if n < 0 && !s.playingLocked(generation) {
+			s.mu.Unlock()
+			return
+		}
+		s.run.Queue.Step(s.run.Ctx)
+		s.mu.Unlock()
+	}
+}
+
+// Waits until the event at time t is due, sending the frames due before it.
+// Returns false if the run stopped playing meanwhile, which cancel tells as
+// soon as it happens.
+func (s *served) pace(pacer *simulator.Pacer, cancel <-chan struct{}, generation int, t time.Time) bool {
+	for {
+		s.mu.Lock()
+		if !s.playingLocked(generation) {
+			s.mu.Unlock()
+			return false
+		}
+		frame, due := s.next_frame, s.every > 0 && !s.next_frame.After(t)
+		s.mu.Unlock()
+		if !due {
+			break
+		}
+
+		if !pacer.Wait(frame, cancel) {
+			return false
+		}
+		s.mu.Lock()
+		if !s.playingLocked(generation) {
+			s.mu.Unlock()
+			return false
+		}
+		s.broadcastLocked("frame", s.run.State().Frame(frame))
+		s.next_frame = frame.Add(s.every)
+		s.mu.Unlock()
+	}
+	return pacer.Wait(t, cancel)
+}
+
+// Marks the run finished and ends its streams
+func (s *served) finishLocked() {
+	s.status = RUN_FINISHED
+	s.stopPlayingLocked()
+	if s.every > 0 {
+		s.broadcastLocked("frame", s.run.State().Frame(s.run.State().Time))
+	}
+	for ch := range s.streams {
+		close(ch)
+		delete(s.streams, ch)
+	}
+}
+
+// Results of a run as returned by the API
+type chainResult struct {
+	ID      string `json:"id"`
+	Height  uint64 `json:"height"`
+	TotalTx int    `json:"total_tx"`
+	MaxTx   int    `json:"max_tx"`
+	Msgs    int    `json:"msgs"`
+}
+
+type metricResult struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+type runResults struct {
+	runStatus
+	Metrics []metricResult `json:"metrics"`
+	Chains  []chainResult  `json:"chains"`
+}
+
+func (s *served) results() runResults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.run.State()
+	res := runResults{runStatus: s.statusLocked(), Metrics: make([]metricResult, 0), Chains: make([]chainResult, 0)}
+	for _, m := range simulator.Summarize(state, s.run.Scenario.LoadThreshold) {
+		res.Metrics = append(res.Metrics, metricResult{m.Name, m.Value})
+	}
+	for _, id := range state.ChainIDs() {
+		if ch, ok := state.Chains[id]; ok {
+			res.Chains = append(res.Chains, chainResult{id, ch.GetHeight(), ch.TotalTx(), ch.GetMaxTxCount(), ch.TotalMsgs()})
+		}
+	}
+	return res
+}
+
+// Server drives runs through a local HTTP/JSON API.
+type Server struct {
+	mu      sync.Mutex
+	runs    map[string]*served
+	next_id int
+}
+
+func NewServer() *Server {
+	return &Server{runs: make(map[string]*served)}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// Sets up a run from a scenario given as JSON. Omitted options keep their defaults.
+func (srv *Server) create(w http.ResponseWriter, r *http.Request) {
+	sc := defaultScenario()
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("bad scenario. %s", err.Error()))
+		return
+	}
+	if sc.Edges == "" {
+		writeError(w, http.StatusBadRequest, errors.New("scenario needs an edges csv file"))
+		return
+	}
+	sc.Quiet = true
+
+	run, err := setupScenario(&sc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	srv.mu.Lock()
+	srv.next_id++
+	s := &served{id: strconv.Itoa(srv.next_id), run: run, status: RUN_PAUSED, streams: make(map[chan message]bool)}
+	srv.runs[s.id] = s
+	srv.mu.Unlock()
+
+	run.Queue.AddObserver(&streamObserver{s: s})
+	writeJSON(w, http.StatusCreated, s.current())
+}
+
+func (srv *Server) list(w http.ResponseWriter) {
+	srv.mu.Lock()
+	ids := make([]string, 0, len(srv.runs))
+	for id := range srv.runs {
+		ids = append(ids, id)
+	}
+	srv.mu.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	statuses := make([]runStatus, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := srv.get(id); ok {
+			statuses = append(statuses, s.current())
+		}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (srv *Server) get(id string) (*served, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	s, ok := srv.runs[id]
+	return s, ok
+}
+
+// Starts a paused run. With a speed, the run plays in real time sped up by
+// that factor, and frames are streamed every frame_every milliseconds of
+// simulated time.
+func (srv *Server) start(w http.ResponseWriter, r *http.Request, s *served) {
+	speed, every := 0.0, int64(0)
+	var err error
+	if v := r.URL.Query().Get("speed"); v != "" {
+		if speed, err = strconv.ParseFloat(v, 64); err != nil || speed < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("speed must be a positive factor"))
+			return
+		}
+	}
+	if v := r.URL.Query().Get("frame_every"); v != "" {
+		if every, err = strconv.ParseInt(v, 10, 64); err != nil || every < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("frame_every must be a positive number of milliseconds"))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if s.status != RUN_PAUSED {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s", s.id, s.status))
+		return
+	}
+	s.status = RUN_RUNNING
+	s.generation++
+	generation := s.generation
+	s.stopPlayingLocked()
+	s.cancel = make(chan struct{})
+	s.pacer, s.every = nil, 0
+	if speed > 0 || every > 0 {
+		state := s.run.State()
+		s.pacer = simulator.NewPacer(speed)
+		s.every = time.Duration(every) * time.Millisecond
+		s.next_frame = state.Start
+		for s.every > 0 && s.next_frame.Before(state.Time) {
+			s.next_frame = s.next_frame.Add(s.every)
+		}
+	}
+	s.mu.Unlock()
+
+	go s.advance(-1, generation)
+	writeJSON(w, http.StatusOK, s.current())
+}
+
+func (srv *Server) pause(w http.ResponseWriter, s *served) {
+	s.mu.Lock()
+	if s.status == RUN_RUNNING {
+		s.status = RUN_PAUSED
+		s.stopPlayingLocked()
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.current())
+}
+
+func (srv *Server) step(w http.ResponseWriter, r *http.Request, s *served) {
+	n := 1
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("n must be a positive number of events"))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if s.status != RUN_PAUSED {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s", s.id, s.status))
+		return
+	}
+	generation := s.generation
+	s.mu.Unlock()
+
+	s.advance(n, generation)
+	writeJSON(w, http.StatusOK, s.current())
+}
+
+// Streams the events of a run as Server-Sent Events until the run finishes
+// or the client goes away.
+func (srv *Server) stream(w http.ResponseWriter, r *http.Request, s *served) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	ch := make(chan message, STREAM_BUFFER)
+	s.mu.Lock()
+	finished := s.status == RUN_FINISHED
+	if !finished {
+		s.streams[ch] = true
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if !finished {
+		for done := false; !done; {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					done = true
+					break
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.kind, msg.data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				s.mu.Lock()
+				if s.streams[ch] {
+					delete(s.streams, ch)
+				}
+				s.mu.Unlock()
+				return
+			}
+		}
+	}
+
+	data, _ := json.Marshal(s.current())
+	fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+	flusher.Flush()
+}
+
+// ServeHTTP routes the requests of the API:
+//
+//	POST   /runs                 set up a run from a scenario
+//	GET    /runs                 list the runs
+//	GET    /runs/{id}            status of a run
+//	DELETE /runs/{id}            forget a run
+//	POST   /runs/{id}/start      run until the end or until paused, in real time with ?speed=X
+//	POST   /runs/{id}/pause      pause a running run
+//	POST   /runs/{id}/step?n=N   run the next N events of a paused run
+//	GET    /runs/{id}/events     stream the events that run as Server-Sent Events
+//	GET    /runs/{id}/results    metrics and chain totals of the run so far
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "runs" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such resource %s", r.URL.Path))
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodPost:
+			srv.create(w, r)
+		case http.MethodGet:
+			srv.list(w)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on /runs", r.Method))
+		}
+		return
+	}
+
+	s, ok := srv.get(parts[1])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run %s", parts[1]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	route := r.Method + " " + action
+	switch route {
+	case "GET ":
+		writeJSON(w, http.StatusOK, s.current())
+	case "DELETE ":
+		// Stops the run and ends its streams
+		s.mu.Lock()
+		s.finishLocked()
+		s.mu.Unlock()
+		srv.mu.Lock()
+		delete(srv.runs, s.id)
+		srv.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case "POST start":
+		srv.start(w, r, s)
+	case "POST pause":
+		srv.pause(w, s)
+	case "POST step":
+		srv.step(w, r, s)
+	case "GET events":
+		srv.stream(w, r, s)
+	case "GET results":
+		writeJSON(w, http.StatusOK, s.results())
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such resource %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// runServe serves the HTTP API until the process is stopped.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	fs.Parse(args)
+
+	fmt.Printf("Serving on http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, NewServer()); err != nil {
+		fmt.Printf("%s\n", err.Error())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SDavidson1177/ThroughputSim/simulator"
+)
+
+// Writes a ring of chains with a shortcut to an edges csv file
+func writeTestEdges(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "edges.csv")
+	if err := os.WriteFile(filename, []byte("1,2\n2,3\n3,4\n4,1\n1,5\n5,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func testScenario(edges string) Scenario {
+	sc := defaultScenario()
+	sc.Edges = edges
+	sc.Sends = 200
+	sc.Seed = 1
+	sc.Quiet = true
+	return sc
+}
+
+// Sends a request to the server and decodes its JSON answer into v
+func call(t *testing.T, srv *httptest.Server, method string, path string, body any, v any) int {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %s", method, path, err.Error())
+		}
+	}
+	return resp.StatusCode
+}
+
+// Waits until the run is finished
+func waitFinished(t *testing.T, srv *httptest.Server, id string) runStatus {
+	t.Helper()
+	var st runStatus
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		call(t, srv, http.MethodGet, "/runs/"+id, nil, &st)
+		if st.Status == RUN_FINISHED {
+			return st
+		}
+	}
+	t.Fatalf("run %s is still %s", id, st.Status)
+	return st
+}
+
+func TestServeRun(t *testing.T) {
+	edges := writeTestEdges(t)
+	sc := testScenario(edges)
+	want, err := runScenario(&sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want_metrics := simulator.Summarize(want.State(), sc.LoadThreshold)
+
+	srv := httptest.NewServer(NewServer())
+	defer srv.Close()
+
+	var st runStatus
+	if code := call(t, srv, http.MethodPost, "/runs", testScenario(edges), &st); code != http.StatusCreated {
+		t.Fatalf("create returned %d", code)
+	}
+	id := st.ID
+
+	// Stream the events while the run is driven
+	resp, err := srv.Client().Get(srv.URL + "/runs/" + id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	streamed := make(chan int)
+	go func() {
+		events := 0
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			switch scanner.Text() {
+			case "event: event":
+				events++
+			case "event: end":
+				streamed <- events
+				return
+			}
+		}
+		streamed <- -1
+	}()
+
+	if call(t, srv, http.MethodPost, "/runs/"+id+"/step?n=5", nil, &st); st.Executed != 5 || st.Status != RUN_PAUSED {
+		t.Fatalf("after 5 steps: %+v", st)
+	}
+
+	// Pausing and starting again must leave a single player of the run
+	for i := 0; i < 20 && st.Status != RUN_FINISHED; i++ {
+		call(t, srv, http.MethodPost, "/runs/"+id+"/start?speed=10&frame_every=1000", nil, &st)
+		call(t, srv, http.MethodPost, "/runs/"+id+"/pause", nil, &st)
+	}
+	if st.Status == RUN_FINISHED {
+		t.Fatalf("the run finished while being paused and started")
+	}
+	if code := call(t, srv, http.MethodPost, "/runs/"+id+"/start", nil, &st); code != http.StatusOK {
+		t.Fatalf("start returned %d", code)
+	}
+	st = waitFinished(t, srv, id)
+
+	var res runResults
+	call(t, srv, http.MethodGet, "/runs/"+id+"/results", nil, &res)
+	if len(res.Metrics) != len(want_metrics) {
+		t.Fatalf("got %d metrics, want %d", len(res.Metrics), len(want_metrics))
+	}
+	got := make([]simulator.Metric, len(res.Metrics))
+	for i, m := range res.Metrics {
+		got[i] = simulator.Metric{Name: m.Name, Value: m.Value}
+	}
+	if !reflect.DeepEqual(got, want_metrics) {
+		t.Fatalf("served run gave %v, want %v", got, want_metrics)
+	}
+
+	select {
+	case events := <-streamed:
+		if events != st.Executed {
+			t.Fatalf("streamed %d events, %d ran", events, st.Executed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the stream did not end")
+	}
+
+	if code := call(t, srv, http.MethodPost, "/runs/"+id+"/start", nil, nil); code != http.StatusConflict {
+		t.Fatalf("starting a finished run returned %d", code)
+	}
+	if code := call(t, srv, http.MethodDelete, "/runs/"+id, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("delete returned %d", code)
+	}
+	if code := call(t, srv, http.MethodGet, "/runs/"+id, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("deleted run returned %d", code)
+	}
+}
@@ -0,0 +1,35 @@
+package simulator
+
+import "time"
+
+// BatchModel configures how relayers bundle messages into transactions.
+type BatchModel struct {
+	MaxSize int           // most messages in a single transaction
+	Window  time.Duration // messages submitted within this time of the first one share a transaction
+}
+
+// An open transaction being filled by a relayer
+type batch struct {
+	height uint64
+	opened time.Time
+	size   int
+}
+
+// addToBatch returns true if the relayer can add a message for the chain to its open
+// transaction. Otherwise, a new transaction is opened and false is returned.
+// A transaction never spans blocks.
+func (s *State) addToBatch(chain *Chain, relayer string) bool {
+	if s.Batching == nil {
+		return false
+	}
+
+	key := relayer + "/" + chain.GetID()
+	b, ok := s.batches[key]
+	if ok && b.height == chain.GetHeight() && s.Time.Sub(b.opened) <= s.Batching.Window && b.size < s.Batching.MaxSize {
+		b.size++
+		return true
+	}
+
+	s.batches[key] = &batch{height: chain.GetHeight(), opened: s.Time, size: 1}
+	return false
+}
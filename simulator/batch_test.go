@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+// A relayer's messages share a transaction until it is full, its window has
+// passed or the chain produces a block
+func TestBatching(t *testing.T) {
+	q, _ := newTestQueue(0)
+	state := q.BatonState
+	state.Batching = &BatchModel{MaxSize: 3, Window: 2 * time.Second}
+	state.Time = state.Start
+	b := state.Chains["b"]
+	relayer := RelayerID("a", "b")
+
+	submit := func(after time.Duration, want bool) {
+		t.Helper()
+		state.Time = state.Time.Add(after)
+		if got := state.addToBatch(b, relayer); got != want {
+			t.Fatalf("message at %v was batched: %v, want %v", state.Time.Sub(state.Start), got, want)
+		}
+	}
+
+	// Flushed on size
+	submit(0, false)
+	submit(0, true)
+	submit(500*time.Millisecond, true)
+	submit(0, false)
+
+	// Flushed on window, counted from the first message
+	submit(time.Second, true)
+	submit(1500*time.Millisecond, false)
+
+	// Other relayers and chains have their own transactions
+	if state.addToBatch(b, RelayerID("b", "c")) || state.addToBatch(state.Chains["a"], relayer) {
+		t.Fatalf("message was added to another relayer's transaction")
+	}
+
+	// Flushed on a new block
+	b.IncHeight()
+	submit(0, false)
+	submit(0, true)
+}
+
+// Batched messages only pay for the transaction once
+func TestBatchedGas(t *testing.T) {
+	q, _ := newTestQueue(0)
+	state := q.BatonState
+	state.Batching = &BatchModel{MaxSize: 2, Window: time.Second}
+	state.Gas.TxGas = 50000
+	b := state.Chains["b"]
+	for i := 0; i < 3; i++ {
+		state.recordMsg(b, MSG_RECV, RelayerID("a", "b"), 0, false)
+	}
+	if b.TxCount() != 2 || b.MsgCount() != 3 {
+		t.Fatalf("%d messages in %d transactions, want 3 in 2", b.MsgCount(), b.TxCount())
+	}
+	if got, want := b.GasUsed(), uint64(3*150000+2*50000); got != want {
+		t.Fatalf("%d gas used, want %d", got, want)
+	}
+}
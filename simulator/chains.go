@@ -1,23 +1,41 @@
 package simulator
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Chain struct {
-	id     string
-	height uint64
+	id         string
+	height     uint64
+	last_block time.Time
+	block_due  time.Time // next block of a slowed chain, between the regular ticks
 
 	// This chain's view of its neighbour
 	view       map[string]uint64
 	neighbours map[string]*Chain
 
-	// Keep track of congestion
-	maxTxCount int
-	txCount    int
-	totalTx    int
+	// Keep track of congestion. A transaction may carry several messages.
+	maxTxCount  int
+	txCount     int
+	totalTx     int
+	wastedTx    int
+	maxMsgCount int
+	msgCount    int
+	totalMsgs   int
+	block_msgs  []int       // messages in the current block by message type
+	total_msgs  []int       // messages by message type
+	redundant   int         // client updates skipped because the chain already had the height
+	block_loads map[int]int // number of blocks by transactions per block
+
+	// Keep track of fees
+	gas_used    uint64
+	native_fees float64 // in the chain's fee token
+	fees        float64 // in the common unit
 }
 
 func NewChain(id string) *Chain {
-	return &Chain{id: id, view: make(map[string]uint64), neighbours: make(map[string]*Chain)}
+	return &Chain{id: id, view: make(map[string]uint64), neighbours: make(map[string]*Chain), block_loads: make(map[int]int)}
 }
 
 func (c *Chain) GetID() string {
@@ -37,11 +55,101 @@ func (c *Chain) IncreaseTxCount() {
 	c.totalTx++
 }
 
+func (c *Chain) IncreaseMsgCount(kind uint32) {
+	c.msgCount++
+	c.totalMsgs++
+	for len(c.block_msgs) <= int(kind) {
+		c.block_msgs = append(c.block_msgs, 0)
+		c.total_msgs = append(c.total_msgs, 0)
+	}
+	c.block_msgs[kind]++
+	c.total_msgs[kind]++
+}
+
+// TotalMsgsOf returns all messages of the given type included on the chain
+func (c *Chain) TotalMsgsOf(kind uint32) int {
+	if int(kind) >= len(c.total_msgs) {
+		return 0
+	}
+	return c.total_msgs[kind]
+}
+
+// IncreaseRedundantUpdates records a client update that was not needed,
+// since the chain already viewed its neighbour at that height.
+func (c *Chain) IncreaseRedundantUpdates() {
+	c.redundant++
+}
+
+func (c *Chain) RedundantUpdates() int {
+	return c.redundant
+}
+
+// TxCount returns the transactions in the current block
+func (c *Chain) TxCount() int {
+	return c.txCount
+}
+
+// MsgCount returns the messages in the current block
+func (c *Chain) MsgCount() int {
+	return c.msgCount
+}
+
+// BlockMsgs returns the messages of the given type in the current block
+func (c *Chain) BlockMsgs(kind uint32) int {
+	if int(kind) >= len(c.block_msgs) {
+		return 0
+	}
+	return c.block_msgs[kind]
+}
+
+// IncreaseWastedTx records a failed message. It is counted on top
+// of the transaction that carried it.
+func (c *Chain) IncreaseWastedTx() {
+	c.wastedTx++
+}
+
+func (c *Chain) WastedTx() int {
+	return c.wastedTx
+}
+
+func (c *Chain) GasUsed() uint64 {
+	return c.gas_used
+}
+
+func (c *Chain) NativeFees() float64 {
+	return c.native_fees
+}
+
+func (c *Chain) Fees() float64 {
+	return c.fees
+}
+
 func (c *Chain) ResetTxCount() {
 	if c.txCount > c.maxTxCount {
 		c.maxTxCount = c.txCount
 	}
+	if c.msgCount > c.maxMsgCount {
+		c.maxMsgCount = c.msgCount
+	}
+	c.block_loads[c.txCount]++
 	c.txCount = 0
+	c.msgCount = 0
+	for i := range c.block_msgs {
+		c.block_msgs[i] = 0
+	}
+}
+
+// BlockLoads returns how many blocks held each number of transactions
+func (c *Chain) BlockLoads() map[int]int {
+	return c.block_loads
+}
+
+func (c *Chain) TotalMsgs() int {
+	return c.totalMsgs
+}
+
+func (c *Chain) GetMaxMsgCount() int {
+	return c.maxMsgCount
 }
 
 func (c *Chain) TotalTx() int {
@@ -67,6 +175,16 @@ func (c *Chain) UpdateView(chain_id string) (bool, error) {
 	return true, nil
 }
 
+// NeedsUpdate returns true when the neighbour does not yet
+// view this chain's current height.
+func (c *Chain) NeedsUpdate(chain_id string) bool {
+	n, ok := c.neighbours[chain_id]
+	if !ok {
+		return false
+	}
+	return c.GetHeight() != n.GetView(c.GetID())
+}
+
 func (c *Chain) GetHeight() uint64 {
 	return c.height
 }
@@ -76,11 +194,41 @@ func (c *Chain) IncHeight() uint64 {
 	return c.height
 }
 
+// LastBlockTime returns the time at which the chain last produced a block.
+func (c *Chain) LastBlockTime() time.Time {
+	return c.last_block
+}
+
+func (c *Chain) SetLastBlockTime(t time.Time) {
+	c.last_block = t
+}
+
+// BlockDue returns the time of the block a slowed chain has scheduled, if any.
+func (c *Chain) BlockDue() time.Time {
+	return c.block_due
+}
+
+// scheduleBlock enqueues the chain's next block at t, unless it already is.
+func (c *Chain) scheduleBlock(state *State, t time.Time) {
+	if c.block_due.Equal(t) {
+		return
+	}
+	c.block_due = t
+	state.Enqueue(NewHeightEvent(t, c.id))
+}
+
 func (c *Chain) AddNeighbour(ch *Chain) {
 	c.neighbours[ch.GetID()] = ch
 	c.view[ch.GetID()] = ch.GetHeight()
 }
 
+// RemoveNeighbour closes the connection to the neighbour. The view of
+// the neighbour is dropped along with it.
+func (c *Chain) RemoveNeighbour(id string) {
+	delete(c.neighbours, id)
+	delete(c.view, id)
+}
+
 func (c *Chain) GetNeighbour(id string) (*Chain, bool) {
 	n, ok := c.neighbours[id]
 	if !ok {
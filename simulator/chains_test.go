@@ -0,0 +1,46 @@
+package simulator
+
+import "testing"
+
+// Messages are counted by type in the current block and over the run
+func TestMsgCounts(t *testing.T) {
+	c := NewChain("a")
+	c.IncreaseMsgCount(MSG_UPDATE)
+	c.IncreaseMsgCount(MSG_RECV)
+	c.IncreaseMsgCount(MSG_RECV)
+	c.IncreaseTxCount()
+	if c.BlockMsgs(MSG_RECV) != 2 || c.BlockMsgs(MSG_ACK) != 0 || c.BlockMsgs(NUM_MSGS+1) != 0 || c.MsgCount() != 3 {
+		t.Fatalf("block has %d recv and %d messages", c.BlockMsgs(MSG_RECV), c.MsgCount())
+	}
+
+	c.ResetTxCount()
+	c.IncreaseMsgCount(MSG_UPDATE)
+	if c.BlockMsgs(MSG_RECV) != 0 || c.BlockMsgs(MSG_UPDATE) != 1 || c.MsgCount() != 1 {
+		t.Fatalf("new block has %d recv and %d updates", c.BlockMsgs(MSG_RECV), c.BlockMsgs(MSG_UPDATE))
+	}
+	if c.TotalMsgsOf(MSG_UPDATE) != 2 || c.TotalMsgsOf(MSG_RECV) != 2 || c.TotalMsgsOf(MSG_TIMEOUT) != 0 || c.TotalMsgs() != 4 {
+		t.Fatalf("run has %d updates, %d recv and %d messages", c.TotalMsgsOf(MSG_UPDATE), c.TotalMsgsOf(MSG_RECV), c.TotalMsgs())
+	}
+	if c.GetMaxMsgCount() != 3 || c.GetMaxTxCount() != 1 {
+		t.Fatalf("fullest block has %d messages and %d txs", c.GetMaxMsgCount(), c.GetMaxTxCount())
+	}
+}
+
+// Chains in the middle of a route only see client updates, and packets are
+// received once on their destination
+func TestBreakdown(t *testing.T) {
+	q, ctx := newTestQueue(10)
+	finish(q, ctx)
+	state := q.BatonState
+
+	if c := state.Chains["c"]; c.TotalMsgsOf(MSG_RECV) != 0 || c.TotalMsgsOf(MSG_UPDATE) == 0 {
+		t.Fatalf("c has %d recv and %d updates", c.TotalMsgsOf(MSG_RECV), c.TotalMsgsOf(MSG_UPDATE))
+	}
+	recv := 0
+	for _, c := range state.Chains {
+		recv += c.TotalMsgsOf(MSG_RECV)
+	}
+	if delivered := state.CountPackets().Delivered; recv != delivered {
+		t.Fatalf("%d packets received for %d delivered", recv, delivered)
+	}
+}
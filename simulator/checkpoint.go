@@ -0,0 +1,438 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ChainSnapshot holds a chain's height, views and counters.
+type ChainSnapshot struct {
+	ID         string
+	Height     uint64
+	LastBlock  time.Time
+	BlockDue   time.Time
+	View       map[string]uint64
+	Neighbours []string
+
+	MaxTxCount  int
+	TxCount     int
+	TotalTx     int
+	WastedTx    int
+	MaxMsgCount int
+	MsgCount    int
+	TotalMsgs   int
+	BlockMsgs   []int
+	MsgsByKind  []int
+	Redundant   int
+	BlockLoads  map[int]int
+
+	GasUsed    uint64
+	NativeFees float64
+	Fees       float64
+}
+
+func (c *Chain) snapshot() ChainSnapshot {
+	neighbours := make([]string, 0, len(c.neighbours))
+	for id := range c.neighbours {
+		neighbours = append(neighbours, id)
+	}
+	sort.Strings(neighbours)
+
+	return ChainSnapshot{
+		ID:          c.id,
+		Height:      c.height,
+		LastBlock:   c.last_block,
+		BlockDue:    c.block_due,
+		View:        c.view,
+		Neighbours:  neighbours,
+		MaxTxCount:  c.maxTxCount,
+		TxCount:     c.txCount,
+		TotalTx:     c.totalTx,
+		WastedTx:    c.wastedTx,
+		MaxMsgCount: c.maxMsgCount,
+		MsgCount:    c.msgCount,
+		TotalMsgs:   c.totalMsgs,
+		BlockMsgs:   c.block_msgs,
+		MsgsByKind:  c.total_msgs,
+		Redundant:   c.redundant,
+		BlockLoads:  c.block_loads,
+		GasUsed:     c.gas_used,
+		NativeFees:  c.native_fees,
+		Fees:        c.fees,
+	}
+}
+
+// Restores everything but the neighbours, which need every chain to exist first
+func restoreChain(cs ChainSnapshot) *Chain {
+	c := NewChain(cs.ID)
+	c.height = cs.Height
+	c.last_block = cs.LastBlock
+	c.block_due = cs.BlockDue
+	for id, h := range cs.View {
+		c.view[id] = h
+	}
+	c.maxTxCount = cs.MaxTxCount
+	c.txCount = cs.TxCount
+	c.totalTx = cs.TotalTx
+	c.wastedTx = cs.WastedTx
+	c.maxMsgCount = cs.MaxMsgCount
+	c.msgCount = cs.MsgCount
+	c.totalMsgs = cs.TotalMsgs
+	c.block_msgs = cs.BlockMsgs
+	c.total_msgs = cs.MsgsByKind
+	c.redundant = cs.Redundant
+	for load, n := range cs.BlockLoads {
+		c.block_loads[load] = n
+	}
+	c.gas_used = cs.GasUsed
+	c.native_fees = cs.NativeFees
+	c.fees = cs.Fees
+	return c
+}
+
+// FaultSnapshot holds the active faults.
+type FaultSnapshot struct {
+	Halted      map[string]int
+	Slow        map[string][]float64
+	Partitioned map[string]int
+	Relayers    map[string]int
+
+	SkippedBlocks      int
+	DeferredUpdates    int
+	DeferredDeliveries int
+}
+
+type routeSnapshot struct {
+	Hops    []string
+	Err     string
+	Changed bool
+}
+
+type batchSnapshot struct {
+	Height uint64
+	Opened time.Time
+	Size   int
+}
+
+type trackerSnapshot struct {
+	Type     uint32
+	Interval uint32
+	Event    EventRecord
+}
+
+// Snapshot is a serializable copy of a simulation: the state, the random
+// number generator and the events waiting in the queue. The queue is kept in
+// heap order, so a restored simulation runs events in exactly the same order.
+type Snapshot struct {
+	Time      time.Time
+	Start     time.Time
+	Seq       uint64
+	Rand      uint64
+	PacketSeq uint64
+
+	Chains   []ChainSnapshot
+	Reserved []string
+	Packets  []*Packet
+	Finished *PacketStats
+	Faults   FaultSnapshot
+	Topology TopologyStats
+
+	Failures     *FailureModel
+	FailureStats FailureStats
+	Acks         bool
+	Gas          *GasSchedule
+	RelayerCosts map[string]*Cost
+	Batching     *BatchModel
+	Batches      map[string]batchSnapshot
+	Recorder     *Recorder
+
+	Routes      map[string]routeSnapshot
+	StaleRoutes map[string]routeSnapshot
+	EdgeTraffic map[string]*EdgeTraffic
+	RouteUses   map[string]*RouteUse
+	Unreachable []Pair
+	Metrics     map[string]float64
+
+	Implicit []trackerSnapshot
+	Queue    []EventRecord // in the order the events run
+	Loaded   []int         // positions in the queue of events that were loaded, not derived
+	Calendar bool          // whether the queue is a calendar queue
+
+	ImplicitStarted bool
+	ImplicitTimer   time.Time
+	Horizon         time.Time
+	ImplicitEvent   int   // position in the queue of the next implicit event, -1 if none
+	Sources         []int // position in the queue of the next event of every source, -1 if none
+}
+
+func snapshotRoutes(routes map[string]*route) map[string]routeSnapshot {
+	snap := make(map[string]routeSnapshot, len(routes))
+	for key, r := range routes {
+		rs := routeSnapshot{Hops: r.hops, Changed: r.changed}
+		if r.err != nil {
+			rs.Err = r.err.Error()
+		}
+		snap[key] = rs
+	}
+	return snap
+}
+
+func restoreRoutes(snap map[string]routeSnapshot) map[string]*route {
+	routes := make(map[string]*route, len(snap))
+	for key, rs := range snap {
+		r := &route{hops: rs.Hops, changed: rs.Changed}
+		if rs.Err != "" {
+			r.err = errors.New(rs.Err)
+		}
+		routes[key] = r
+	}
+	return routes
+}
+
+// Copy returns a deep copy of the snapshot.
+func (snap *Snapshot) Copy() (*Snapshot, error) {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	c := &Snapshot{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Snapshot copies the queue's state and pending events. The copy shares
+// nothing with the queue, so the queue can keep running.
+func (q *EventQueue) Snapshot() (*Snapshot, error) {
+	s := q.BatonState
+	snap := &Snapshot{
+		Time:      s.Time,
+		Start:     s.Start,
+		Seq:       s.Seq,
+		Rand:      s.Rand.State,
+		PacketSeq: s.packet_seq,
+		Faults: FaultSnapshot{
+			Halted:             s.Faults.halted,
+			Slow:               s.Faults.slow,
+			Partitioned:        s.Faults.partitioned,
+			Relayers:           s.Faults.relayers,
+			SkippedBlocks:      s.Faults.SkippedBlocks,
+			DeferredUpdates:    s.Faults.DeferredUpdates,
+			DeferredDeliveries: s.Faults.DeferredDeliveries,
+		},
+		Topology:     s.Topology,
+		Finished:     s.Finished,
+		Failures:     s.Failures,
+		FailureStats: s.FailureStats,
+		Acks:         s.Acks,
+		Gas:          s.Gas,
+		RelayerCosts: s.RelayerCosts,
+		Batching:     s.Batching,
+		Batches:      make(map[string]batchSnapshot, len(s.batches)),
+		Recorder:     s.Recorder,
+		Routes:       snapshotRoutes(s.routes),
+		StaleRoutes:  snapshotRoutes(s.stale_routes),
+		EdgeTraffic:  s.edge_traffic,
+		RouteUses:    s.route_uses,
+		Metrics:      s.metrics,
+	}
+
+	for _, id := range s.ChainIDs() {
+		if ch, ok := s.Chains[id]; ok {
+			snap.Chains = append(snap.Chains, ch.snapshot())
+		} else {
+			snap.Reserved = append(snap.Reserved, id)
+		}
+	}
+
+	ids := make([]uint64, 0, len(s.Packets))
+	for id := range s.Packets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		snap.Packets = append(snap.Packets, s.Packets[id])
+	}
+
+	for key, b := range s.batches {
+		snap.Batches[key] = batchSnapshot{Height: b.height, Opened: b.opened, Size: b.size}
+	}
+	snap.Unreachable = s.UnreachablePairs()
+
+	for _, t := range s.implicit_tracker {
+		rec, err := EncodeEvent(t.Evnt)
+		if err != nil {
+			return nil, err
+		}
+		snap.Implicit = append(snap.Implicit, trackerSnapshot{Type: t.Type, Interval: t.Interval, Event: rec})
+	}
+
+	snap.Calendar = q.Calendar()
+	snap.ImplicitStarted = q.implicit_started
+	snap.ImplicitTimer = q.implicit_timer
+	snap.Horizon = q.horizon
+	snap.ImplicitEvent = -1
+	snap.Sources = make([]int, len(q.sources))
+	for i := range snap.Sources {
+		snap.Sources[i] = -1
+	}
+	for i, x := range q.pending() {
+		rec, err := EncodeEvent(x.event)
+		if err != nil {
+			return nil, err
+		}
+		snap.Queue = append(snap.Queue, rec)
+		if x.loaded {
+			snap.Loaded = append(snap.Loaded, i)
+		}
+		if x.implicit {
+			snap.ImplicitEvent = i
+		}
+		if x.source > 0 {
+			snap.Sources[x.source-1] = i
+		}
+	}
+
+	// The chains, packets and counters above are still those of the queue
+	return snap.Copy()
+}
+
+// RestoreQueue creates a queue with its own state from a snapshot. Running
+// the restored queue gives the same results as running the original one.
+// The queue shares nothing with the snapshot, so a snapshot can be restored
+// any number of times, for example to fork a warmed up network.
+func RestoreQueue(snap *Snapshot) (*EventQueue, error) {
+	snap, err := snap.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewEventQueue()
+	s := q.BatonState
+
+	s.Time = snap.Time
+	s.Start = snap.Start
+	s.Seq = snap.Seq
+	s.Rand = &Rand{State: snap.Rand}
+	s.packet_seq = snap.PacketSeq
+
+	for _, cs := range snap.Chains {
+		s.AddChain(restoreChain(cs))
+	}
+	for _, cs := range snap.Chains {
+		for _, n := range cs.Neighbours {
+			neighbour, ok := s.Chains[n]
+			if !ok {
+				return nil, fmt.Errorf("cannot find neighbour %s of chain %s", n, cs.ID)
+			}
+			s.Chains[cs.ID].neighbours[n] = neighbour
+		}
+	}
+	for _, id := range snap.Reserved {
+		s.reserved[id] = true
+	}
+
+	for _, p := range snap.Packets {
+		s.Packets[p.ID] = p
+	}
+	s.Finished = snap.Finished
+
+	if snap.Faults.Halted != nil {
+		s.Faults.halted = snap.Faults.Halted
+	}
+	if snap.Faults.Slow != nil {
+		s.Faults.slow = snap.Faults.Slow
+	}
+	if snap.Faults.Partitioned != nil {
+		s.Faults.partitioned = snap.Faults.Partitioned
+	}
+	if snap.Faults.Relayers != nil {
+		s.Faults.relayers = snap.Faults.Relayers
+	}
+	s.Faults.SkippedBlocks = snap.Faults.SkippedBlocks
+	s.Faults.DeferredUpdates = snap.Faults.DeferredUpdates
+	s.Faults.DeferredDeliveries = snap.Faults.DeferredDeliveries
+	s.Topology = snap.Topology
+
+	s.Failures = snap.Failures
+	s.FailureStats = snap.FailureStats
+	s.Acks = snap.Acks
+	if snap.Gas != nil {
+		s.Gas = snap.Gas
+	}
+	if snap.RelayerCosts != nil {
+		s.RelayerCosts = snap.RelayerCosts
+	}
+	s.Batching = snap.Batching
+	for key, b := range snap.Batches {
+		s.batches[key] = &batch{height: b.Height, opened: b.Opened, size: b.Size}
+	}
+	s.Recorder = snap.Recorder
+
+	s.routes = restoreRoutes(snap.Routes)
+	s.stale_routes = restoreRoutes(snap.StaleRoutes)
+	if snap.EdgeTraffic != nil {
+		s.edge_traffic = snap.EdgeTraffic
+	}
+	if snap.RouteUses != nil {
+		s.route_uses = snap.RouteUses
+	}
+	for _, p := range snap.Unreachable {
+		s.unreachable[p] = true
+	}
+	for name, v := range snap.Metrics {
+		s.metrics[name] = v
+	}
+
+	for _, t := range snap.Implicit {
+		e, err := DecodeEvent(t.Event)
+		if err != nil {
+			return nil, err
+		}
+		s.implicit_tracker = append(s.implicit_tracker, ImplicitEventTracker{Type: t.Type, Interval: t.Interval, Evnt: e})
+	}
+
+	// The events are in the order they run. They were all scheduled before
+	// the events that are yet to be, so numbering them in that order keeps it.
+	events := make([]queued, 0, len(snap.Queue))
+	for i, rec := range snap.Queue {
+		e, err := DecodeEvent(rec)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, q.entryAt(e, uint64(i), false))
+	}
+	for _, i := range snap.Loaded {
+		if i < 0 || i >= len(events) {
+			return nil, fmt.Errorf("loaded event %d is not in the queue", i)
+		}
+		events[i].loaded = true
+	}
+
+	q.implicit_started = snap.ImplicitStarted
+	q.implicit_timer = snap.ImplicitTimer
+	q.horizon = snap.Horizon
+	if i := snap.ImplicitEvent; i >= 0 && i < len(events) {
+		events[i].implicit = true
+		q.implicit_pending = true
+	}
+	// Sources are given back with ResumeSource
+	q.sources = make([]Source, len(snap.Sources))
+	for s, i := range snap.Sources {
+		if i >= len(events) {
+			return nil, fmt.Errorf("event %d of source %d is not in the queue", i, s)
+		}
+		if i >= 0 {
+			events[i].source = int32(s + 1)
+		}
+	}
+	if snap.Calendar {
+		q.UseCalendarQueue()
+	}
+	q.queue.load(events)
+	return q, nil
+}
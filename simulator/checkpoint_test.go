@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Creates a queue of sends over a line of chains
+func newTestQueue(sends int) (*EventQueue, context.Context) {
+	q := NewEventQueue()
+	state := q.BatonState
+	state.Log = nil
+	state.Rand = NewRand(1)
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		state.AddChain(NewChain(id))
+	}
+	state.OpenConnection("a", "b")
+	state.OpenConnection("b", "c")
+	state.OpenConnection("c", "d")
+	q.Init()
+
+	for i := 0; i < sends; i++ {
+		t := state.Start.Add(time.Duration(i) * 700 * time.Millisecond)
+		q.AddEventToLoad(NewSendEvent(t, "a", "d"))
+		q.AddEventToLoad(NewSendEvent(t, "d", "b"))
+	}
+	q.LoadEventsIntoQueue()
+	return q, NewContext(state, false, nil)
+}
+
+func runUntil(q *EventQueue, ctx context.Context, t time.Time) {
+	for next := q.Next(); next != nil && next.Time().Before(t); next = q.Next() {
+		q.Step(ctx)
+	}
+}
+
+func finish(q *EventQueue, ctx context.Context) []Metric {
+	for q.Step(ctx) == nil {
+	}
+	return Summarize(q.BatonState, 10)
+}
+
+func TestRestoreTwice(t *testing.T) {
+	q, ctx := newTestQueue(20)
+	runUntil(q, ctx, q.BatonState.Start.Add(7*time.Second))
+	snap, err := q.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := len(snap.Packets)
+	want := finish(q, ctx)
+	if len(snap.Packets) != packets {
+		t.Fatalf("running the queue changed the snapshot")
+	}
+
+	first, err := RestoreQueue(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RestoreQueue(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := Summarize(second.BatonState, 10)
+
+	if got := finish(first, NewContext(first.BatonState, false, nil)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored run gave %v, want %v", got, want)
+	}
+	if got := Summarize(second.BatonState, 10); !reflect.DeepEqual(got, before) {
+		t.Fatalf("running one restored queue changed another: %v, was %v", got, before)
+	}
+	if got := finish(second, NewContext(second.BatonState, false, nil)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("second restored run gave %v, want %v", got, want)
+	}
+}
@@ -1,5 +1,7 @@
 package simulator
 
+import "context"
+
 const (
 	StateContextKey  = "CTX_State"
 	HubsContextKey   = "CTX_Hubs"
@@ -13,3 +15,17 @@ type ContextKey struct {
 func GetContextKey(key string) ContextKey {
 	return ContextKey{Key: key}
 }
+
+// NewContext creates the context that events run in. Packets are routed
+// through the hub chains, and directly when direct is true.
+func NewContext(state *State, direct bool, hubs []string) context.Context {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, GetContextKey(StateContextKey), state)
+	ctx = context.WithValue(ctx, GetContextKey(DirectContextKey), direct)
+
+	hub_chains := make(map[string]bool)
+	for _, c := range hubs {
+		hub_chains[c] = true
+	}
+	return context.WithValue(ctx, GetContextKey(HubsContextKey), hub_chains)
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+)
+
+// EdgeTraffic counts what was relayed over a connection in one direction.
+type EdgeTraffic struct {
+	Updates int // client updates of the sending chain submitted to the receiving chain
+	Packets int // packets routed over the connection
+}
+
+// Edge is the traffic over a connection between chains A and B in both directions.
+type Edge struct {
+	A  string
+	B  string
+	AB EdgeTraffic
+	BA EdgeTraffic
+}
+
+func (e *Edge) Updates() int {
+	return e.AB.Updates + e.BA.Updates
+}
+
+func (e *Edge) Packets() int {
+	return e.AB.Packets + e.BA.Packets
+}
+
+// Total returns the client updates and packets carried in both directions.
+func (e *Edge) Total() int {
+	return e.Updates() + e.Packets()
+}
+
+// Returns the counters for traffic from src to dst
+func (s *State) edgeTraffic(src, dst string) *EdgeTraffic {
+	key := src + ">" + dst
+	t, ok := s.edge_traffic[key]
+	if !ok {
+		t = &EdgeTraffic{}
+		s.edge_traffic[key] = t
+	}
+	return t
+}
+
+// recordRoute counts a packet on every connection of its route.
+func (s *State) recordRoute(src string, hops []string) {
+	prev := src
+	for _, hop := range hops {
+		s.edgeTraffic(prev, hop).Packets++
+		prev = hop
+	}
+}
+
+// Traffic returns what was relayed from src to dst.
+func (s *State) Traffic(src, dst string) EdgeTraffic {
+	if t, ok := s.edge_traffic[src+">"+dst]; ok {
+		return *t
+	}
+	return EdgeTraffic{}
+}
+
+// EdgeTable returns the traffic of every connection that carried any, sorted
+// by its chains. Connections that were closed during the run are included.
+func (s *State) EdgeTable() []Edge {
+	seen := make(map[string]bool)
+	edges := make([]Edge, 0)
+	for key := range s.edge_traffic {
+		src, dst, _ := strings.Cut(key, ">")
+		if src > dst {
+			src, dst = dst, src
+		}
+		if seen[ConnectionKey(src, dst)] {
+			continue
+		}
+		seen[ConnectionKey(src, dst)] = true
+		edges = append(edges, Edge{A: src, B: dst, AB: s.Traffic(src, dst), BA: s.Traffic(dst, src)})
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+	return edges
+}
+
+// Bottlenecks returns up to n connections carrying the most traffic, busiest first.
+func Bottlenecks(edges []Edge, n int) []Edge {
+	sorted := append([]Edge{}, edges...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Total() > sorted[j].Total()
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,64 @@
+package simulator
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Packets are counted on every connection of their route, in the direction
+// they cross it
+func TestEdgeTraffic(t *testing.T) {
+	q, ctx := newTestQueue(10)
+	finish(q, ctx)
+	state := q.BatonState
+
+	// a sends to d over a, b, c, d and d sends to b over d, c, b
+	sent := state.CountPackets().Sent / 2
+	tests := []struct {
+		src, dst string
+		packets  int
+	}{
+		{"a", "b", sent}, {"b", "c", sent}, {"c", "d", sent},
+		{"d", "c", sent}, {"c", "b", sent}, {"b", "a", 0},
+	}
+	for _, test := range tests {
+		if got := state.Traffic(test.src, test.dst).Packets; got != test.packets {
+			t.Fatalf("%d packets from %s to %s, want %d", got, test.src, test.dst, test.packets)
+		}
+	}
+
+	edges := state.EdgeTable()
+	pairs := make([][2]string, len(edges))
+	for i, e := range edges {
+		pairs[i] = [2]string{e.A, e.B}
+		if e.AB != state.Traffic(e.A, e.B) || e.BA != state.Traffic(e.B, e.A) {
+			t.Fatalf("edge %s-%s is %+v", e.A, e.B, e)
+		}
+		if e.Updates() == 0 {
+			t.Fatalf("no client updates over %s-%s", e.A, e.B)
+		}
+	}
+	if want := [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}}; !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("edges are %v, want %v", pairs, want)
+	}
+}
+
+func TestBottlenecks(t *testing.T) {
+	edges := []Edge{
+		{A: "a", B: "b", AB: EdgeTraffic{Updates: 1, Packets: 1}},
+		{A: "b", B: "c", AB: EdgeTraffic{Packets: 5}, BA: EdgeTraffic{Updates: 2}},
+		{A: "c", B: "d", BA: EdgeTraffic{Packets: 2}},
+		{A: "d", B: "e", AB: EdgeTraffic{Updates: 7}},
+	}
+	got := Bottlenecks(edges, 3)
+	want := []Edge{edges[1], edges[3], edges[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bottlenecks are %v, want %v", got, want)
+	}
+	if edges[0].A != "a" {
+		t.Fatalf("bottlenecks reordered the edges")
+	}
+	if got := Bottlenecks(edges, 10); len(got) != 4 {
+		t.Fatalf("%d bottlenecks of 4 edges", len(got))
+	}
+}
@@ -14,6 +14,13 @@ const (
 	SEND_EVENT_TYPE        = 3
 	DELIVER_EVENT_TYPE     = 4
 	SEND_SINGLE_EVENT_TYPE = 5
+	FAULT_EVENT_TYPE       = 6
+	TOPOLOGY_EVENT_TYPE    = 7
+	TIMEOUT_EVENT_TYPE     = 8
+	ACK_EVENT_TYPE         = 9
+	DIJKSTRA_EVENT_TYPE    = 10 // only used to find shortest paths, never queued
+
+	FIRST_CUSTOM_EVENT_TYPE = 1000 // custom event types registered by users of the package
 )
 
 type Event interface {
@@ -79,12 +86,14 @@ func (e *GenSendEvent) AdjustTime(et time.Time) {
 type UpdateEvent struct {
 	event_time time.Time
 	following  []Event
+	packet     uint64 // packet that triggered the update
 	chain      string
 	neighbour  string
+	attempts   int // failed submissions so far
 }
 
-func NewUpdateEvent(t time.Time, chain_id string, neighbour_id string) *UpdateEvent {
-	return &UpdateEvent{event_time: t, following: make([]Event, 0), chain: chain_id, neighbour: neighbour_id}
+func NewUpdateEvent(t time.Time, packet uint64, chain_id string, neighbour_id string) *UpdateEvent {
+	return &UpdateEvent{event_time: t, following: make([]Event, 0), packet: packet, chain: chain_id, neighbour: neighbour_id}
 }
 
 func (e *UpdateEvent) Execute(ctx context.Context) {
@@ -95,13 +104,36 @@ func (e *UpdateEvent) Execute(ctx context.Context) {
 
 	ch, ok := state.Chains[e.chain]
 	if !ok {
-		fmt.Printf("failed to update. Could not find chain %s\n", e.chain)
+		state.Logf("failed to update. Could not find chain %s\n", e.chain)
+		state.MarkLost(e.packet)
+		return
+	}
+
+	// The relayer cannot submit the update while the connection is faulty.
+	// Try again once the next block has been produced.
+	if state.Faults.Blocks(e.chain, e.neighbour) {
+		state.Logf("Update of chain %s to view chain %s blocked by fault: %v\n", e.neighbour, e.chain, e.Time())
+		state.Faults.DeferredUpdates++
+		delayEvent(e, FAULT_RETRY_INTERVAL*time.Millisecond)
+		state.Enqueue(e)
 		return
 	}
 
+	// The relayer's submission may fail
+	if ch.NeedsUpdate(e.neighbour) {
+		if reason := state.drawFailure(false); reason != FAILURE_NONE {
+			e.attempts++
+			state.Logf("Update of chain %s to view chain %s failed (%s): %v\n", e.neighbour, e.chain, FailureName(reason), e.Time())
+			if !state.handleFailure(e, state.Chains[e.neighbour], MSG_UPDATE, RelayerID(e.chain, e.neighbour), e.packet, reason, e.attempts) {
+				return
+			}
+		}
+	}
+
 	var updated bool
 	if updated, err = ch.UpdateView(e.neighbour); err != nil {
-		fmt.Printf("could not update view. %s\n", err.Error())
+		state.Logf("could not update view. %s\n", err.Error())
+		state.MarkLost(e.packet)
 		return
 	}
 
@@ -110,10 +142,12 @@ func (e *UpdateEvent) Execute(ctx context.Context) {
 
 	// Update the amount of transactions received at this block height
 	if updated {
-		fmt.Printf("Updated chain %s to view chain %s at height %d: %v\n", e.neighbour, e.chain, ch.GetHeight(), e.Time())
-		state.Chains[e.neighbour].IncreaseTxCount()
+		state.Logf("Updated chain %s to view chain %s at height %d: %v\n", e.neighbour, e.chain, ch.GetHeight(), e.Time())
+		state.recordMsg(state.Chains[e.neighbour], MSG_UPDATE, RelayerID(e.chain, e.neighbour), e.packet, false)
+		state.edgeTraffic(e.chain, e.neighbour).Updates++
 	} else {
-		fmt.Printf("Chain %s already views chain %s at height %d: %v\n", e.neighbour, e.chain, ch.GetHeight(), e.Time())
+		state.Logf("Chain %s already views chain %s at height %d: %v\n", e.neighbour, e.chain, ch.GetHeight(), e.Time())
+		state.Chains[e.neighbour].IncreaseRedundantUpdates()
 	}
 
 	// Enqueue next update if there is one to follow
@@ -126,8 +160,11 @@ func (e *UpdateEvent) Execute(ctx context.Context) {
 		if (follow.Type() == UPDATE_EVENT_TYPE && !updated) || follow.Type() == DELIVER_EVENT_TYPE {
 			// adjust time of next update event so that it is triggered immediately
 			follow.AdjustTime(e.Time())
+		} else if follow.Time().Before(e.Time()) {
+			// This update was held back, so the next one cannot run earlier
+			follow.AdjustTime(e.Time())
 		}
-		MainEventQueue.Enqueue(follow)
+		state.Enqueue(follow)
 	}
 }
 
@@ -136,7 +173,9 @@ func (e *UpdateEvent) Type() uint64 {
 }
 
 func (e *UpdateEvent) Copy() Event {
-	return NewUpdateEvent(e.Time(), e.chain, e.neighbour)
+	copy := NewUpdateEvent(e.Time(), e.packet, e.chain, e.neighbour)
+	copy.attempts = e.attempts
+	return copy
 }
 
 func (e *UpdateEvent) Time() time.Time {
@@ -181,10 +220,37 @@ func (e *HeightEvent) Execute(ctx context.Context) {
 	}
 
 	if chain, ok := state.Chains[e.chain]; ok {
-		chain.ResetTxCount()
+		// A halted chain does not produce blocks. A slowed chain only
+		// produces a block once its extended block time has passed, so
+		// the regular ticks before then are skipped and the block is
+		// scheduled for when it is due.
+		if state.Faults.IsHalted(chain.GetID()) {
+			state.Faults.SkippedBlocks++
+			state.Logf("Chain %s is halted at height %d: %v\n", chain.GetID(), chain.GetHeight(), e.Time())
+			return
+		}
+
+		factor := state.Faults.BlockTimeFactor(chain.GetID())
+		block_time := time.Duration(factor*IMPLICIT_HEIGHT_INTERVAL) * time.Millisecond
+		if !chain.LastBlockTime().IsZero() && e.Time().Sub(chain.LastBlockTime()) < block_time {
+			state.Faults.SkippedBlocks++
+			if factor != 1 {
+				chain.scheduleBlock(state, chain.LastBlockTime().Add(block_time))
+			}
+			return
+		}
+
 		val := chain.IncHeight()
-		_ = val
-		fmt.Printf("Height of chain %s increased to %d: %v\n", chain.GetID(), val, e.Time())
+		if state.Recorder != nil {
+			state.Recorder.RecordBlock(chain, state.Start, e.Time())
+		}
+		chain.ResetTxCount()
+		chain.SetLastBlockTime(e.Time())
+		if factor != 1 {
+			chain.scheduleBlock(state, e.Time().Add(block_time))
+		}
+		state.Logf("Height of chain %s increased to %d: %v\n", chain.GetID(), val, e.Time())
+		state.heightChanged(chain)
 	}
 }
 
@@ -225,25 +291,42 @@ type SendEvent struct {
 	event_time time.Time
 	following  []Event
 	src_chain  string
+	dst_chain  string
 	hops       []string // chain hops not including the source chain
 }
 
-func NewSendEvent(t time.Time, src_chain string, hops []string) *SendEvent {
-	return &SendEvent{event_time: t, following: make([]Event, 0), src_chain: src_chain, hops: hops}
+// The route to the destination is resolved when the send is executed,
+// so that it reflects the topology at that time.
+func NewSendEvent(t time.Time, src_chain string, dst_chain string) *SendEvent {
+	return &SendEvent{event_time: t, following: make([]Event, 0), src_chain: src_chain, dst_chain: dst_chain}
 }
 
 func (e *SendEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	sp, err := state.useRoute(ctx, e.src_chain, e.dst_chain)
+	if err != nil {
+		state.Logf("Cannot send from chain %s to chain %s. %s: %v\n", e.src_chain, e.dst_chain, err.Error(), e.Time())
+		return
+	}
+	e.hops = sp[1:]
+
 	// Create update events
 	if len(e.hops) < 1 {
 		return
 	}
+	packet := state.NewPacket(e.Time(), e.src_chain, e.hops)
+	state.recordRoute(e.src_chain, e.hops)
 
 	update_events := make([]Event, len(e.hops))
 	a := e.src_chain
 	for i := range e.hops {
 		b := e.hops[i]
 		d, _ := time.ParseDuration(fmt.Sprintf("%dms", int(math.Round(float64(i)*1.233*IMPLICIT_HEIGHT_INTERVAL))))
-		update_events[i] = NewUpdateEvent(e.Time().Add(d), a, b)
+		update_events[i] = NewUpdateEvent(e.Time().Add(d), packet.ID, a, b)
 		a = b
 
 		// Add the following update event
@@ -255,12 +338,13 @@ func (e *SendEvent) Execute(ctx context.Context) {
 	// Add the deliver event
 	update_events[len(update_events)-1].SetFollowing([]Event{NewDeliverEvent(
 		update_events[len(update_events)-1].Time(),
+		packet.ID,
 		e.src_chain,
 		e.hops[len(e.hops)-1],
 	)})
 
 	// Only enqueue the first update event. The rest will be triggered as needed
-	MainEventQueue.Enqueue(update_events[0])
+	state.Enqueue(update_events[0])
 }
 
 func (e *SendEvent) Type() uint64 {
@@ -268,7 +352,9 @@ func (e *SendEvent) Type() uint64 {
 }
 
 func (e *SendEvent) Copy() Event {
-	return NewSendEvent(e.Time(), e.src_chain, e.hops)
+	copy := NewSendEvent(e.Time(), e.src_chain, e.dst_chain)
+	copy.hops = e.hops
+	return copy
 }
 
 func (e *SendEvent) Time() time.Time {
@@ -299,12 +385,14 @@ func (e *SendEvent) AdjustTime(t time.Time) {
 type DeliverEvent struct {
 	event_time time.Time
 	following  []Event
+	packet     uint64
 	src        string
 	dst        string
+	attempts   int // failed submissions so far
 }
 
-func NewDeliverEvent(t time.Time, src, dst string) *DeliverEvent {
-	return &DeliverEvent{event_time: t, following: make([]Event, 0), src: src, dst: dst}
+func NewDeliverEvent(t time.Time, packet uint64, src, dst string) *DeliverEvent {
+	return &DeliverEvent{event_time: t, following: make([]Event, 0), packet: packet, src: src, dst: dst}
 }
 
 func (e *DeliverEvent) Execute(ctx context.Context) {
@@ -313,9 +401,58 @@ func (e *DeliverEvent) Execute(ctx context.Context) {
 		return
 	}
 
-	if chain, ok := state.Chains[e.dst]; ok {
-		chain.IncreaseTxCount()
-		fmt.Printf("Delivering messages from chain %s to chain %s: %v\n", e.src, chain.GetID(), e.Time())
+	chain, ok := state.Chains[e.dst]
+	if !ok {
+		state.Logf("failed to deliver. Could not find chain %s\n", e.dst)
+		state.MarkLost(e.packet)
+		return
+	}
+
+	// The packet is relayed over the last connection on its route
+	prev := e.src
+	if p, ok := state.Packets[e.packet]; ok {
+		prev = p.PrevHop(e.dst)
+	}
+	relayer := RelayerID(prev, e.dst)
+
+	// The packet cannot be included while the connection is faulty.
+	// Try again after the next block.
+	if state.Faults.Blocks(prev, chain.GetID()) {
+		state.Logf("Delivery from chain %s to chain %s blocked by fault: %v\n", e.src, chain.GetID(), e.Time())
+		state.Faults.DeferredDeliveries++
+		delayEvent(e, FAULT_RETRY_INTERVAL*time.Millisecond)
+		state.Enqueue(e)
+		return
+	}
+
+	// Give up on packets that can no longer be received
+	if state.isTimedOut(e.packet, e.Time()) {
+		state.timeoutPacket(e.packet, e.Time())
+		return
+	}
+
+	// The relayer's submission may fail
+	if reason := state.drawFailure(true); reason != FAILURE_NONE {
+		e.attempts++
+		state.Logf("Delivery from chain %s to chain %s failed (%s): %v\n", e.src, chain.GetID(), FailureName(reason), e.Time())
+		if !state.handleFailure(e, chain, MSG_RECV, relayer, e.packet, reason, e.attempts) {
+			return
+		}
+	}
+
+	state.recordMsg(chain, MSG_RECV, relayer, e.packet, false)
+	state.MarkDelivered(e.packet, chain.GetID(), e.Time())
+	state.Logf("Delivering messages from chain %s to chain %s: %v\n", e.src, chain.GetID(), e.Time())
+
+	// The acknowledgement is written in the next block and relayed back to the source.
+	// Without one, the packet is finished.
+	if p, ok := state.Packets[e.packet]; ok && p.Delivered && p.Dst == chain.GetID() {
+		if state.Acks {
+			d, _ := time.ParseDuration(fmt.Sprintf("%dms", IMPLICIT_HEIGHT_INTERVAL))
+			state.Enqueue(NewAckEvent(e.Time().Add(d), p.ID))
+		} else {
+			state.finishPacket(p)
+		}
 	}
 }
 
@@ -324,7 +461,9 @@ func (e *DeliverEvent) Type() uint64 {
 }
 
 func (e *DeliverEvent) Copy() Event {
-	return NewDeliverEvent(e.Time(), e.src, e.dst)
+	copy := NewDeliverEvent(e.Time(), e.packet, e.src, e.dst)
+	copy.attempts = e.attempts
+	return copy
 }
 
 func (e *DeliverEvent) Time() time.Time {
@@ -351,6 +490,79 @@ func (e *DeliverEvent) AdjustTime(t time.Time) {
 	e.event_time = t
 }
 
+// Ack event. Submits a packet acknowledgement on the packet's source chain.
+type AckEvent struct {
+	event_time time.Time
+	packet     uint64
+}
+
+func NewAckEvent(t time.Time, packet uint64) *AckEvent {
+	return &AckEvent{event_time: t, packet: packet}
+}
+
+func (e *AckEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	p, ok := state.Packets[e.packet]
+	if !ok {
+		return
+	}
+
+	chain, ok := state.Chains[p.Src]
+	if !ok {
+		state.Logf("failed to acknowledge packet. Could not find chain %s\n", p.Src)
+		state.finishPacket(p)
+		return
+	}
+
+	// The acknowledgement is relayed back over the first connection on the route
+	if state.Faults.Blocks(p.Hops[0], chain.GetID()) {
+		state.Faults.DeferredDeliveries++
+		delayEvent(e, FAULT_RETRY_INTERVAL*time.Millisecond)
+		state.Enqueue(e)
+		return
+	}
+
+	state.recordMsg(chain, MSG_ACK, RelayerID(p.Src, p.Hops[0]), p.ID, false)
+	p.Acked = true
+	state.Logf("Acknowledging packet %d from chain %s on chain %s: %v\n", p.ID, p.Dst, p.Src, e.Time())
+	state.finishPacket(p)
+}
+
+func (e *AckEvent) Type() uint64 {
+	return ACK_EVENT_TYPE
+}
+
+func (e *AckEvent) Copy() Event {
+	return NewAckEvent(e.Time(), e.packet)
+}
+
+func (e *AckEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *AckEvent) AddMsg() {
+	fmt.Printf("Adding ack event with time: %v\n", e.Time())
+}
+
+func (t *AckEvent) SubEvents() []Event {
+	return nil
+}
+
+func (e *AckEvent) Following() []Event {
+	return nil
+}
+
+func (e *AckEvent) SetFollowing(events []Event) {
+}
+
+func (e *AckEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
+
 // Dijkstra event. Not to be loaded into main event queue. Just so that we can use event heap.
 type DijkstraEvent struct {
 	Distance int
@@ -365,7 +577,7 @@ func (e *DijkstraEvent) Execute(ctx context.Context) {
 }
 
 func (e *DijkstraEvent) Type() uint64 {
-	return DELIVER_EVENT_TYPE
+	return DIJKSTRA_EVENT_TYPE
 }
 
 func (e *DijkstraEvent) Copy() Event {
@@ -400,48 +612,59 @@ type SendSingleEvent struct {
 	event_time time.Time
 	following  []Event
 	src_chain  string
+	dst_chain  string
 	hops       []string // chain hops not including the source chain
-	iteration  int
+	packet     uint64
 }
 
-func NewSendSingleEvent(t time.Time, src_chain string, hops []string) *SendSingleEvent {
-	return &SendSingleEvent{event_time: t, following: make([]Event, 0), src_chain: src_chain, hops: hops, iteration: 0}
+// The route to the destination is resolved when the send runs.
+func NewSendSingleEvent(t time.Time, src_chain string, dst_chain string) *SendSingleEvent {
+	return &SendSingleEvent{event_time: t, following: make([]Event, 0), src_chain: src_chain, dst_chain: dst_chain}
 }
 
 func (e *SendSingleEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	// The packet is created when the send runs
+	if e.packet == 0 {
+		sp, err := state.useRoute(ctx, e.src_chain, e.dst_chain)
+		if err != nil {
+			state.Logf("Cannot send from chain %s to chain %s. %s: %v\n", e.src_chain, e.dst_chain, err.Error(), e.Time())
+			return
+		}
+		e.hops = sp[1:]
+		if len(e.hops) < 1 {
+			return
+		}
+		e.packet = state.NewPacket(e.Time(), e.src_chain, e.hops).ID
+	}
+
 	// Create update events
 	if len(e.hops) < 1 {
 		return
 	}
 
+	state.recordRoute(e.src_chain, e.hops[:1])
+
 	// This update and deliver event
-	d, _ := time.ParseDuration(fmt.Sprintf("%dms", int(math.Round(float64(e.iteration)*1.233*IMPLICIT_HEIGHT_INTERVAL))))
-	update_event := NewUpdateEvent(e.Time().Add(d), e.src_chain, e.hops[0])
-	deliver_event := NewDeliverEvent(e.Time().Add(d), e.src_chain, e.hops[0])
+	update_event := NewUpdateEvent(e.Time(), e.packet, e.src_chain, e.hops[0])
+	deliver_event := NewDeliverEvent(e.Time(), e.packet, e.src_chain, e.hops[0])
 	update_event.SetFollowing([]Event{deliver_event})
 
-	// The next send event
-	if len(e.hops) > 1 {
-		next_send := e.Copy().(*SendSingleEvent)
-
-		next_send.iteration++
-		d, _ := time.ParseDuration(fmt.Sprintf("%dms", int(math.Round(float64(next_send.iteration)*1.233*IMPLICIT_HEIGHT_INTERVAL))))
-		next_send.AdjustTime(next_send.Time().Add(d))
-		next_send.src_chain = next_send.hops[0]
-		next_send.hops = next_send.hops[1:]
-		deliver_event.SetFollowing([]Event{deliver_event})
-	}
-
-	MainEventQueue.Enqueue(update_event)
+	state.Enqueue(update_event)
 }
 
 func (e *SendSingleEvent) Type() uint64 {
-	return SEND_EVENT_TYPE
+	return SEND_SINGLE_EVENT_TYPE
 }
 
 func (e *SendSingleEvent) Copy() Event {
-	copy := NewSendSingleEvent(e.Time(), e.src_chain, e.hops)
-	copy.iteration = e.iteration
+	copy := NewSendSingleEvent(e.Time(), e.src_chain, e.dst_chain)
+	copy.hops = e.hops
+	copy.packet = e.packet
 	return copy
 }
 
@@ -0,0 +1,143 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// EventEntry is an event in an event list. Event lists are written as JSON
+// lines and give times as offsets from the start of the simulation, so the
+// same list can be loaded into any run.
+type EventEntry struct {
+	At        string          `json:"at"` // offset from the start, e.g. "1.5s"
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Following []EventEntry    `json:"following,omitempty"`
+
+	// Derived events are created by the simulation itself, such as the
+	// updates of a send, and are skipped when a trace is loaded.
+	Derived bool `json:"derived,omitempty"`
+}
+
+// NewEventEntry encodes an event as an entry of an event list.
+func NewEventEntry(e Event, start time.Time) (EventEntry, error) {
+	rec, err := EncodeEvent(e)
+	if err != nil {
+		return EventEntry{}, err
+	}
+	return recordEntry(rec, start), nil
+}
+
+func recordEntry(rec EventRecord, start time.Time) EventEntry {
+	entry := EventEntry{At: rec.Time.Sub(start).String(), Kind: rec.Kind, Data: rec.Data}
+	for _, f := range rec.Following {
+		entry.Following = append(entry.Following, recordEntry(f, start))
+	}
+	return entry
+}
+
+// Record converts the entry to the encoding of an event happening after start.
+func (entry EventEntry) Record(start time.Time) (EventRecord, error) {
+	at, err := time.ParseDuration(entry.At)
+	if err != nil {
+		return EventRecord{}, fmt.Errorf("bad time of %s event. %s", entry.Kind, err.Error())
+	}
+
+	rec := EventRecord{Kind: entry.Kind, Time: start.Add(at), Data: entry.Data}
+	for _, f := range entry.Following {
+		frec, err := f.Record(start)
+		if err != nil {
+			return EventRecord{}, err
+		}
+		rec.Following = append(rec.Following, frec)
+	}
+	return rec, nil
+}
+
+// ReadEventList reads the events of an event list, timed from start. Blank
+// lines and lines starting with '#' are skipped, as are derived events.
+func ReadEventList(r io.Reader, start time.Time) ([]Event, error) {
+	events := make([]Event, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var entry EventEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		if entry.Derived {
+			continue
+		}
+
+		rec, err := entry.Record(start)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		e, err := DecodeEvent(rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// EventWriter writes events as an event list. The first error stops the
+// writer and is returned by every later call.
+type EventWriter struct {
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Time
+	err   error
+}
+
+func NewEventWriter(w io.Writer, start time.Time) *EventWriter {
+	bw := bufio.NewWriter(w)
+	return &EventWriter{w: bw, enc: json.NewEncoder(bw), start: start}
+}
+
+// Write adds an event to the list.
+func (ew *EventWriter) Write(e Event) error {
+	return ew.write(e, false)
+}
+
+// WriteDerived adds an event created by the simulation itself to the list.
+func (ew *EventWriter) WriteDerived(e Event) error {
+	return ew.write(e, true)
+}
+
+func (ew *EventWriter) write(e Event, derived bool) error {
+	if ew.err != nil {
+		return ew.err
+	}
+
+	entry, err := NewEventEntry(e, ew.start)
+	if err != nil {
+		ew.err = err
+		return err
+	}
+	entry.Derived = derived
+	ew.err = ew.enc.Encode(entry)
+	return ew.err
+}
+
+// Flush writes any buffered events to the underlying writer.
+func (ew *EventWriter) Flush() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	ew.err = ew.w.Flush()
+	return ew.err
+}
@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var customMetrics []string
+var customMetricSet = make(map[string]bool)
+
+// RegisterMetric registers a custom metric. Custom metrics are summarized
+// after the built in ones, in the order they were registered, and are 0 in
+// runs that never add to them. Names are unique.
+func RegisterMetric(name string) error {
+	if customMetricSet[name] {
+		return fmt.Errorf("metric %s is already registered", name)
+	}
+	customMetricSet[name] = true
+	customMetrics = append(customMetrics, name)
+	return nil
+}
+
+func eventMetric(name string) string {
+	return name + "_events"
+}
+
+// Counts an event of a custom type that ran
+func (s *State) countEvent(kind uint64) {
+	if et, ok := LookupEventType(kind); ok {
+		s.metrics[eventMetric(et.Name)]++
+	}
+}
+
+// Sim is the handle through which events reach the simulation they run in:
+// its state, clock, random numbers and queue. It stays valid for the whole
+// run and refers to that run only, whichever queue the run uses.
+type Sim struct {
+	state *State
+}
+
+// SimFromContext returns the handle of the simulation that an event runs in.
+func SimFromContext(ctx context.Context) (*Sim, error) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return state.Sim(), nil
+}
+
+// Sim returns the handle of the simulation that the state belongs to.
+func (s *State) Sim() *Sim {
+	return &Sim{state: s}
+}
+
+// Sim returns the handle of the simulation that the queue runs.
+func (q *EventQueue) Sim() *Sim {
+	return q.BatonState.Sim()
+}
+
+// State returns the state of the simulation.
+func (sim *Sim) State() *State {
+	return sim.state
+}
+
+// Now returns the time of the event being run.
+func (sim *Sim) Now() time.Time {
+	return sim.state.Time
+}
+
+// Start returns the time at which the simulation started.
+func (sim *Sim) Start() time.Time {
+	return sim.state.Start
+}
+
+// Rand returns the random number generator of the simulation. Drawing all
+// random numbers from it keeps runs with the same seed identical.
+func (sim *Sim) Rand() *Rand {
+	return sim.state.Rand
+}
+
+// Chain returns a chain of the network, if it is part of it.
+func (sim *Sim) Chain(id string) (*Chain, bool) {
+	ch, ok := sim.state.Chains[id]
+	return ch, ok
+}
+
+// Logf writes to the simulation's log, if there is one.
+func (sim *Sim) Logf(format string, a ...any) {
+	sim.state.Logf(format, a...)
+}
+
+// Schedule adds an event to the queue. The event cannot happen before the
+// event being run.
+func (sim *Sim) Schedule(e Event) error {
+	if e.Time().Before(sim.state.Time) {
+		return fmt.Errorf("cannot schedule an event at %v before the current time %v", e.Time(), sim.state.Time)
+	}
+	sim.state.Enqueue(e)
+	return nil
+}
+
+// Submit books a message relayed by the relayer onto a chain. Like the built
+// in messages, it takes up block space, uses MSG_CUSTOM gas and is charged to
+// the chain and the relayer. Halted chains do not take any messages.
+func (sim *Sim) Submit(chain_id string, relayer string) error {
+	ch, ok := sim.state.Chains[chain_id]
+	if !ok {
+		return fmt.Errorf("could not find chain %s", chain_id)
+	}
+	if sim.state.Faults.IsHalted(chain_id) {
+		return fmt.Errorf("chain %s is halted", chain_id)
+	}
+	sim.state.recordMsg(ch, MSG_CUSTOM, relayer, 0, false)
+	return nil
+}
+
+// Add adds to a custom metric registered with RegisterMetric.
+func (sim *Sim) Add(metric string, value float64) error {
+	if !customMetricSet[metric] {
+		return fmt.Errorf("metric %s is not registered", metric)
+	}
+	sim.state.metrics[metric] += value
+	return nil
+}
+
+// Metric returns the value of a custom metric.
+func (sim *Sim) Metric(metric string) float64 {
+	return sim.state.metrics[metric]
+}
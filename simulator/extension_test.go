@@ -0,0 +1,144 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const TEST_EVENT_TYPE = FIRST_CUSTOM_EVENT_TYPE + 43
+
+// A custom event that submits a message on a chain and repeats itself
+type testEvent struct {
+	event_time time.Time
+	chain      string
+	repeats    int
+}
+
+type testEventData struct {
+	Chain   string `json:"chain"`
+	Repeats int    `json:"repeats"`
+}
+
+func init() {
+	err := RegisterEventType(TEST_EVENT_TYPE, "test",
+		func(e *testEvent) testEventData { return testEventData{e.chain, e.repeats} },
+		func(t time.Time, d testEventData) *testEvent {
+			return &testEvent{event_time: t, chain: d.Chain, repeats: d.Repeats}
+		})
+	if err != nil {
+		panic(err)
+	}
+	if err := RegisterMetric("test_submitted"); err != nil {
+		panic(err)
+	}
+}
+
+func (e *testEvent) Execute(ctx context.Context) {
+	sim, err := SimFromContext(ctx)
+	if err != nil {
+		return
+	}
+	if sim.Submit(e.chain, RelayerID("a", e.chain)) == nil {
+		sim.Add("test_submitted", 1)
+	}
+	if e.repeats > 0 {
+		sim.Schedule(&testEvent{event_time: sim.Now().Add(time.Second), chain: e.chain, repeats: e.repeats - 1})
+	}
+}
+
+func (e *testEvent) Type() uint64                { return TEST_EVENT_TYPE }
+func (e *testEvent) Copy() Event                 { c := *e; return &c }
+func (e *testEvent) Time() time.Time             { return e.event_time }
+func (e *testEvent) AddMsg()                     {}
+func (e *testEvent) SubEvents() []Event          { return nil }
+func (e *testEvent) Following() []Event          { return nil }
+func (e *testEvent) SetFollowing(events []Event) {}
+func (e *testEvent) AdjustTime(t time.Time)      { e.event_time = t }
+
+// Custom events run through the Sim handle: they submit messages, add to
+// their metrics and schedule more events, and are counted as they run
+func TestCustomEvents(t *testing.T) {
+	q := NewEventQueue()
+	state := q.BatonState
+	state.Log = nil
+	state.Rand = NewRand(1)
+	state.AddChain(NewChain("a"))
+	state.AddChain(NewChain("b"))
+	state.OpenConnection("a", "b")
+	q.Init()
+	q.AddEventToLoad(&testEvent{event_time: state.Start, chain: "b", repeats: 4})
+	q.AddEventToLoad(&testEvent{event_time: state.Start, chain: "x"})
+	q.LoadEventsIntoQueue()
+	finish(q, NewContext(state, false, nil))
+
+	sim := q.Sim()
+	if got := sim.Metric("test_submitted"); got != 5 {
+		t.Fatalf("%v messages submitted, want 5", got)
+	}
+	if got := sim.Metric("test_events"); got != 6 {
+		t.Fatalf("%v test events counted, want 6", got)
+	}
+	if got := state.Chains["b"].TotalMsgsOf(MSG_CUSTOM); got != 5 {
+		t.Fatalf("%d custom messages on b, want 5", got)
+	}
+	if got, want := state.Chains["b"].GasUsed(), 5*state.Gas.Gas[MSG_CUSTOM]; got != want {
+		t.Fatalf("b used %d gas, want %d", got, want)
+	}
+
+	found := false
+	for _, m := range Summarize(state, 10) {
+		if m.Name == "test_submitted" {
+			found = m.Value == 5
+		}
+	}
+	if !found {
+		t.Fatalf("custom metric is not summarized")
+	}
+}
+
+func TestSimErrors(t *testing.T) {
+	q, _ := newTestQueue(0)
+	state := q.BatonState
+	state.Time = state.Start.Add(time.Second)
+	sim := q.Sim()
+
+	if err := sim.Schedule(&testEvent{event_time: state.Start}); err == nil {
+		t.Fatalf("scheduled an event before the current time")
+	}
+	if err := sim.Add("not_registered", 1); err == nil {
+		t.Fatalf("added to a metric that is not registered")
+	}
+	if err := sim.Submit("x", "a:x"); err == nil {
+		t.Fatalf("submitted to a chain that does not exist")
+	}
+	state.Faults.Apply(&Fault{Kind: FAULT_HALT, Chain: "a"}, true)
+	if err := sim.Submit("a", "a:b"); err == nil {
+		t.Fatalf("submitted to a halted chain")
+	}
+
+	if err := RegisterEventType(TEST_EVENT_TYPE, "other", func(e *testEvent) int { return 0 }, func(t time.Time, d int) *testEvent { return nil }); err == nil {
+		t.Fatalf("registered an event type twice")
+	}
+	if err := RegisterEventType(FIRST_CUSTOM_EVENT_TYPE-1, "reserved", func(e *testEvent) int { return 0 }, func(t time.Time, d int) *testEvent { return nil }); err == nil {
+		t.Fatalf("registered a reserved event type")
+	}
+	if err := RegisterMetric("test_submitted"); err == nil {
+		t.Fatalf("registered a metric twice")
+	}
+}
+
+// Custom events are encoded and decoded like the built in ones
+func TestCustomEventEncoding(t *testing.T) {
+	data, err := MarshalEventBinary(&testEvent{event_time: time.Unix(5, 0), chain: "b", repeats: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := UnmarshalEventBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := e.(*testEvent); !ok || got.chain != "b" || got.repeats != 2 || !got.Time().Equal(time.Unix(5, 0)) {
+		t.Fatalf("decoded %+v", e)
+	}
+}
@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	FAILURE_NONE              = 0
+	FAILURE_OUT_OF_GAS        = 1 // the transaction ran out of gas
+	FAILURE_SEQUENCE_MISMATCH = 2 // the relayer's account sequence was out of date
+	FAILURE_RELAYER_RACE      = 3 // another relayer submitted the same message first
+	NUM_FAILURES              = 4
+)
+
+var failureNames = [NUM_FAILURES]string{"none", "out of gas", "sequence mismatch", "relayer race"}
+
+func FailureName(reason uint32) string {
+	if reason >= NUM_FAILURES {
+		return "unknown"
+	}
+	return failureNames[reason]
+}
+
+// FailureRates gives the probability of each failure reason for a single submission.
+// Indexed by the FAILURE_* constants.
+type FailureRates [NUM_FAILURES]float64
+
+// FailureModel configures how relayed messages fail and how they are retried.
+type FailureModel struct {
+	Update  FailureRates // client update submissions
+	Deliver FailureRates // packet deliveries
+
+	MaxRetries    int           // failed attempts allowed before the packet is given up on
+	RetryDelay    time.Duration // wait before the first retry
+	Backoff       float64       // multiplier applied to the delay after every retry
+	PacketTimeout time.Duration // packets not received within this duration time out. Zero for no timeout
+}
+
+func NewFailureModel() *FailureModel {
+	return &FailureModel{
+		MaxRetries: 3,
+		RetryDelay: IMPLICIT_HEIGHT_INTERVAL * time.Millisecond,
+		Backoff:    1,
+	}
+}
+
+// retryDelay returns the wait before the given retry, starting at 1
+func (m *FailureModel) retryDelay(attempt int) time.Duration {
+	return time.Duration(float64(m.RetryDelay) * math.Pow(m.Backoff, float64(attempt-1)))
+}
+
+// FailureStats counts failed submissions and their consequences.
+type FailureStats struct {
+	Failed   [NUM_FAILURES]int // failed attempts by reason
+	Retries  int
+	TimedOut int
+}
+
+// drawFailure returns the reason a submission failed, or FAILURE_NONE.
+func (s *State) drawFailure(deliver bool) uint32 {
+	if s.Failures == nil {
+		return FAILURE_NONE
+	}
+
+	rates := s.Failures.Update
+	if deliver {
+		rates = s.Failures.Deliver
+	}
+
+	r := s.Rand.Float64()
+	for reason := uint32(1); reason < NUM_FAILURES; reason++ {
+		if r < rates[reason] {
+			return reason
+		}
+		r -= rates[reason]
+	}
+	return FAILURE_NONE
+}
+
+// handleFailure books a failed attempt as a wasted transaction on the chain.
+// When another relayer won the race, the message still lands and true is returned.
+// Otherwise, the event is retried until the retries are used up, after which
+// the packet times out.
+func (s *State) handleFailure(e Event, chain *Chain, kind uint32, relayer string, packet uint64, reason uint32, attempt int) bool {
+	s.recordMsg(chain, kind, relayer, packet, true)
+	s.FailureStats.Failed[reason]++
+	if p, ok := s.Packets[packet]; ok {
+		p.Attempts++
+	}
+
+	if reason == FAILURE_RELAYER_RACE {
+		return true
+	}
+
+	if attempt <= s.Failures.MaxRetries {
+		s.FailureStats.Retries++
+		delayEvent(e, s.Failures.retryDelay(attempt))
+		s.Enqueue(e)
+		return false
+	}
+
+	s.timeoutPacket(packet, e.Time())
+	return false
+}
+
+// isTimedOut returns true if the packet can no longer be received at time t.
+func (s *State) isTimedOut(packet uint64, t time.Time) bool {
+	p, ok := s.Packets[packet]
+	if !ok || s.Failures == nil || s.Failures.PacketTimeout == 0 {
+		return false
+	}
+	return t.After(p.SentAt.Add(s.Failures.PacketTimeout))
+}
+
+// timeoutPacket gives up on delivering the packet. The timeout is submitted on the
+// source chain once the packet's timeout has passed.
+func (s *State) timeoutPacket(packet uint64, t time.Time) {
+	p, ok := s.Packets[packet]
+	if !ok || p.TimedOut || p.Delivered {
+		return
+	}
+	p.TimedOut = true
+
+	if s.Failures != nil && s.Failures.PacketTimeout > 0 && p.SentAt.Add(s.Failures.PacketTimeout).After(t) {
+		t = p.SentAt.Add(s.Failures.PacketTimeout)
+	}
+	s.Enqueue(NewTimeoutEvent(t, packet))
+}
+
+// Timeout event. Submits a packet timeout on the packet's source chain.
+type TimeoutEvent struct {
+	event_time time.Time
+	packet     uint64
+}
+
+func NewTimeoutEvent(t time.Time, packet uint64) *TimeoutEvent {
+	return &TimeoutEvent{event_time: t, packet: packet}
+}
+
+func (e *TimeoutEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	p, ok := state.Packets[e.packet]
+	if !ok {
+		return
+	}
+
+	chain, ok := state.Chains[p.Src]
+	if !ok {
+		state.Logf("failed to time out packet. Could not find chain %s\n", p.Src)
+		state.finishPacket(p)
+		return
+	}
+
+	// The timeout is relayed back over the first connection on the route
+	if state.Faults.Blocks(p.Hops[0], chain.GetID()) {
+		state.Faults.DeferredDeliveries++
+		delayEvent(e, FAULT_RETRY_INTERVAL*time.Millisecond)
+		state.Enqueue(e)
+		return
+	}
+
+	state.recordMsg(chain, MSG_TIMEOUT, RelayerID(p.Src, p.Hops[0]), p.ID, false)
+	state.FailureStats.TimedOut++
+	state.Logf("Timing out packet %d from chain %s to chain %s: %v\n", p.ID, p.Src, p.Dst, e.Time())
+	state.finishPacket(p)
+}
+
+func (e *TimeoutEvent) Type() uint64 {
+	return TIMEOUT_EVENT_TYPE
+}
+
+func (e *TimeoutEvent) Copy() Event {
+	return NewTimeoutEvent(e.Time(), e.packet)
+}
+
+func (e *TimeoutEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *TimeoutEvent) AddMsg() {
+	fmt.Printf("Adding timeout event with time: %v\n", e.Time())
+}
+
+func (e *TimeoutEvent) SubEvents() []Event {
+	return nil
+}
+
+func (e *TimeoutEvent) Following() []Event {
+	return nil
+}
+
+func (e *TimeoutEvent) SetFollowing(events []Event) {
+}
+
+func (e *TimeoutEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
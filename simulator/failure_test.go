@@ -0,0 +1,74 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	m := NewFailureModel()
+	m.Backoff = 2
+	for attempt, want := range []time.Duration{4 * time.Second, 8 * time.Second, 16 * time.Second} {
+		if got := m.retryDelay(attempt + 1); got != want {
+			t.Fatalf("retry %d is after %v, want %v", attempt+1, got, want)
+		}
+	}
+}
+
+// Runs the test queue with every delivery failing for the given reason
+func runFailing(reason uint32, retries int) *State {
+	q, ctx := newTestQueue(10)
+	state := q.BatonState
+	state.Failures = NewFailureModel()
+	state.Failures.MaxRetries = retries
+	state.Failures.Deliver[reason] = 1
+	finish(q, ctx)
+	return state
+}
+
+// Failed deliveries are retried until the retries are used up, and the
+// packet then times out on its source chain
+func TestFailedDeliveries(t *testing.T) {
+	state := runFailing(FAILURE_OUT_OF_GAS, 2)
+	packets := state.CountPackets()
+	if packets.Delivered != 0 || packets.TimedOut != packets.Sent || state.FailureStats.TimedOut != packets.Sent {
+		t.Fatalf("%d packets delivered and %d timed out of %d", packets.Delivered, packets.TimedOut, packets.Sent)
+	}
+	if got, want := state.FailureStats.Failed[FAILURE_OUT_OF_GAS], 3*packets.Sent; got != want {
+		t.Fatalf("%d failed deliveries, want %d", got, want)
+	}
+	if got, want := state.FailureStats.Retries, 2*packets.Sent; got != want {
+		t.Fatalf("%d retries, want %d", got, want)
+	}
+}
+
+// A relayer that loses the race still gets the packet delivered
+func TestRelayerRace(t *testing.T) {
+	state := runFailing(FAILURE_RELAYER_RACE, 2)
+	packets := state.CountPackets()
+	if packets.Delivered != packets.Sent || state.FailureStats.Retries != 0 {
+		t.Fatalf("%d packets delivered of %d after %d retries", packets.Delivered, packets.Sent, state.FailureStats.Retries)
+	}
+	if got := state.FailureStats.Failed[FAILURE_RELAYER_RACE]; got != packets.Sent {
+		t.Fatalf("%d races lost, want %d", got, packets.Sent)
+	}
+}
+
+// Packets not delivered within the timeout time out when it passes
+func TestPacketTimeout(t *testing.T) {
+	q, ctx := newTestQueue(10)
+	state := q.BatonState
+	state.Failures = NewFailureModel()
+	state.Failures.PacketTimeout = time.Second
+	finish(q, ctx)
+
+	packets := state.CountPackets()
+	if packets.TimedOut == 0 || packets.TimedOut+packets.Delivered != packets.Sent {
+		t.Fatalf("%d packets timed out and %d delivered of %d", packets.TimedOut, packets.Delivered, packets.Sent)
+	}
+	for _, p := range state.Packets {
+		if p.Delivered && p.Latency() > time.Second {
+			t.Fatalf("packet %d was delivered after %v", p.ID, p.Latency())
+		}
+	}
+}
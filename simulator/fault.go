@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	FAULT_HALT      = 0 // chain stops producing blocks
+	FAULT_SLOW      = 1 // chain block time is multiplied by a factor
+	FAULT_PARTITION = 2 // connection between two chains cannot carry messages
+	FAULT_RELAYER   = 3 // the relayer serving a connection is offline
+
+	FAULT_RETRY_INTERVAL = IMPLICIT_HEIGHT_INTERVAL // wait one block before retrying a blocked message
+)
+
+// Fault describes a failure that is active between Start and End.
+type Fault struct {
+	Kind   uint32
+	Chain  string
+	Peer   string  // counterparty chain for connection faults
+	Factor float64 // block time multiplier for FAULT_SLOW
+	Start  time.Time
+	End    time.Time
+}
+
+func (f *Fault) String() string {
+	switch f.Kind {
+	case FAULT_HALT:
+		return fmt.Sprintf("halt %s", f.Chain)
+	case FAULT_SLOW:
+		return fmt.Sprintf("slow %s x%.2f", f.Chain, f.Factor)
+	case FAULT_PARTITION:
+		return fmt.Sprintf("partition %s-%s", f.Chain, f.Peer)
+	case FAULT_RELAYER:
+		return fmt.Sprintf("relayer %s-%s", f.Chain, f.Peer)
+	}
+	return "unknown fault"
+}
+
+// ConnectionKey returns an identifier for the connection between two chains.
+// The identifier does not depend on the order of the chains.
+func ConnectionKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// FaultState keeps track of the faults that are currently active, and
+// how much work was held back because of them.
+type FaultState struct {
+	halted      map[string]int
+	slow        map[string][]float64
+	partitioned map[string]int
+	relayers    map[string]int
+
+	SkippedBlocks      int
+	DeferredUpdates    int
+	DeferredDeliveries int
+}
+
+func NewFaultState() *FaultState {
+	return &FaultState{
+		halted:      make(map[string]int),
+		slow:        make(map[string][]float64),
+		partitioned: make(map[string]int),
+		relayers:    make(map[string]int),
+	}
+}
+
+// Apply activates the fault when active is true. Otherwise, the fault is lifted.
+// Overlapping faults of the same kind are tracked independently.
+func (fs *FaultState) Apply(f *Fault, active bool) {
+	inc := 1
+	if !active {
+		inc = -1
+	}
+
+	switch f.Kind {
+	case FAULT_HALT:
+		fs.halted[f.Chain] += inc
+	case FAULT_SLOW:
+		if active {
+			fs.slow[f.Chain] = append(fs.slow[f.Chain], f.Factor)
+			break
+		}
+		for i, factor := range fs.slow[f.Chain] {
+			if factor == f.Factor {
+				fs.slow[f.Chain] = append(fs.slow[f.Chain][:i], fs.slow[f.Chain][i+1:]...)
+				break
+			}
+		}
+	case FAULT_PARTITION:
+		fs.partitioned[ConnectionKey(f.Chain, f.Peer)] += inc
+	case FAULT_RELAYER:
+		fs.relayers[ConnectionKey(f.Chain, f.Peer)] += inc
+	}
+}
+
+func (fs *FaultState) IsHalted(chain_id string) bool {
+	return fs.halted[chain_id] > 0
+}
+
+// BlockTimeFactor returns the multiplier applied to the chain's block time.
+// When several slow downs overlap, the largest one applies.
+func (fs *FaultState) BlockTimeFactor(chain_id string) float64 {
+	factor := 1.0
+	for _, f := range fs.slow[chain_id] {
+		if f > factor {
+			factor = f
+		}
+	}
+	return factor
+}
+
+func (fs *FaultState) IsPartitioned(a, b string) bool {
+	return fs.partitioned[ConnectionKey(a, b)] > 0
+}
+
+func (fs *FaultState) IsRelayerDown(a, b string) bool {
+	return fs.relayers[ConnectionKey(a, b)] > 0
+}
+
+// Blocks returns true if a message relayed from chain src cannot
+// currently be included on chain dst.
+func (fs *FaultState) Blocks(src, dst string) bool {
+	return fs.IsHalted(dst) || fs.IsPartitioned(src, dst) || fs.IsRelayerDown(src, dst)
+}
+
+// delayEvent pushes an event, and every event that follows it, back by d.
+func delayEvent(e Event, d time.Duration) {
+	e.AdjustTime(e.Time().Add(d))
+	for _, follow := range e.Following() {
+		delayEvent(follow, d)
+	}
+}
+
+// Fault event. Activates or lifts a fault.
+type FaultEvent struct {
+	event_time time.Time
+	fault      *Fault
+	active     bool
+}
+
+func NewFaultEvent(t time.Time, fault *Fault, active bool) *FaultEvent {
+	return &FaultEvent{event_time: t, fault: fault, active: active}
+}
+
+// Fault returns the fault that the event activates or lifts.
+func (e *FaultEvent) Fault() *Fault {
+	return e.fault
+}
+
+// Active is true if the event activates the fault and false if it lifts it.
+func (e *FaultEvent) Active() bool {
+	return e.active
+}
+
+func (e *FaultEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	state.Faults.Apply(e.fault, e.active)
+	if e.active {
+		state.Logf("Fault started: %s: %v\n", e.fault, e.Time())
+	} else {
+		state.Logf("Fault ended: %s: %v\n", e.fault, e.Time())
+	}
+}
+
+func (e *FaultEvent) Type() uint64 {
+	return FAULT_EVENT_TYPE
+}
+
+func (e *FaultEvent) Copy() Event {
+	return NewFaultEvent(e.Time(), e.fault, e.active)
+}
+
+func (e *FaultEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *FaultEvent) AddMsg() {
+	fmt.Printf("Adding fault event with time: %v\n", e.Time())
+}
+
+func (e *FaultEvent) SubEvents() []Event {
+	return nil
+}
+
+func (e *FaultEvent) Following() []Event {
+	return nil
+}
+
+func (e *FaultEvent) SetFollowing(events []Event) {
+}
+
+func (e *FaultEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
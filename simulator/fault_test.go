@@ -0,0 +1,151 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Records when each chain produces a block
+type blockTimes struct {
+	BaseObserver
+	times map[string][]time.Time
+}
+
+func (o *blockTimes) OnHeight(sim *Sim, chain *Chain) {
+	o.times[chain.GetID()] = append(o.times[chain.GetID()], sim.Now())
+}
+
+func watchBlocks(q *EventQueue) *blockTimes {
+	o := &blockTimes{times: make(map[string][]time.Time)}
+	q.AddObserver(o)
+	return o
+}
+
+// Creates the queue of newTestQueue with the faults loaded as well. The
+// times of the faults are taken from the start of the simulation.
+func newFaultQueue(sends int, faults ...*Fault) (*EventQueue, context.Context) {
+	q, ctx := newTestQueue(sends)
+	for _, f := range faults {
+		f.Start = q.BatonState.Start.Add(f.Start.Sub(time.Time{}))
+		f.End = q.BatonState.Start.Add(f.End.Sub(time.Time{}))
+		q.AddEventToLoad(NewFaultEvent(f.Start, f, true))
+		q.AddEventToLoad(NewFaultEvent(f.End, f, false))
+	}
+	q.LoadEventsIntoQueue()
+	return q, ctx
+}
+
+// A time given in seconds, for newFaultQueue
+func at(seconds int) time.Time {
+	return time.Time{}.Add(time.Duration(seconds) * time.Second)
+}
+
+// A slowed chain spaces its blocks by the extended block time, even when it
+// is not a multiple of the regular one
+func TestSlowBlockSpacing(t *testing.T) {
+	fault := &Fault{Kind: FAULT_SLOW, Chain: "b", Factor: 1.5, Start: at(10), End: at(60)}
+	q, ctx := newFaultQueue(120, fault)
+	state := q.BatonState
+	start, end := fault.Start, fault.End
+	blocks := watchBlocks(q)
+
+	runUntil(q, ctx, state.Start.Add(80*time.Second))
+	want := time.Duration(1.5*IMPLICIT_HEIGHT_INTERVAL) * time.Millisecond
+	slowed := 0
+	times := blocks.times["b"]
+	for i := 1; i < len(times); i++ {
+		if times[i-1].Before(start) || times[i].After(end) {
+			continue
+		}
+		if gap := times[i].Sub(times[i-1]); gap != want {
+			t.Fatalf("block at %v came %v after the last, want %v", times[i].Sub(state.Start), gap, want)
+		}
+		slowed++
+	}
+	if slowed < 5 {
+		t.Fatalf("only %d blocks while slowed", slowed)
+	}
+
+	// The other chains keep their block time
+	times = blocks.times["a"]
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap != IMPLICIT_HEIGHT_INTERVAL*time.Millisecond {
+			t.Fatalf("block of a came %v after the last", gap)
+		}
+	}
+}
+
+// Records when packets reach each chain and when they are acknowledged
+type packetTimes struct {
+	BaseObserver
+	delivered map[string][]time.Time
+	acked     map[string][]time.Time
+}
+
+func (o *packetTimes) OnDelivery(sim *Sim, p *Packet) {
+	o.delivered[p.Dst] = append(o.delivered[p.Dst], sim.Now())
+}
+
+func (o *packetTimes) AfterEvent(sim *Sim, e Event) {
+	if ack, ok := e.(*AckEvent); ok {
+		if p, ok := sim.State().Packets[ack.packet]; ok && p.Acked {
+			o.acked[p.Src] = append(o.acked[p.Src], sim.Now())
+		}
+	}
+}
+
+// Counts the times within the fault and after it
+func during(times []time.Time, f *Fault) (within int, after int) {
+	for _, t := range times {
+		if t.After(f.Start) && t.Before(f.End) {
+			within++
+		} else if !t.Before(f.End) {
+			after++
+		}
+	}
+	return within, after
+}
+
+// Nothing crosses a faulty connection while the fault lasts, and the held
+// back messages go through once it is lifted
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault *Fault
+		times func(*blockTimes, *packetTimes) []time.Time
+	}{
+		{"halt blocks", &Fault{Kind: FAULT_HALT, Chain: "d"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return b.times["d"] }},
+		{"halt deliveries", &Fault{Kind: FAULT_HALT, Chain: "d"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return p.delivered["d"] }},
+		{"partition deliveries", &Fault{Kind: FAULT_PARTITION, Chain: "c", Peer: "d"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return p.delivered["d"] }},
+		{"relayer deliveries", &Fault{Kind: FAULT_RELAYER, Chain: "d", Peer: "c"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return p.delivered["d"] }},
+		{"partition acks", &Fault{Kind: FAULT_PARTITION, Chain: "a", Peer: "b"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return p.acked["a"] }},
+		{"relayer acks", &Fault{Kind: FAULT_RELAYER, Chain: "b", Peer: "a"},
+			func(b *blockTimes, p *packetTimes) []time.Time { return p.acked["a"] }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fault.Start, test.fault.End = at(5), at(15)
+			q, ctx := newFaultQueue(30, test.fault)
+			q.BatonState.Acks = true
+			blocks := watchBlocks(q)
+			packets := &packetTimes{delivered: make(map[string][]time.Time), acked: make(map[string][]time.Time)}
+			q.AddObserver(packets)
+			finish(q, ctx)
+
+			within, after := during(test.times(blocks, packets), test.fault)
+			if within != 0 {
+				t.Fatalf("%d went through during %s", within, test.fault)
+			}
+			if after == 0 {
+				t.Fatalf("nothing went through after %s", test.fault)
+			}
+		})
+	}
+}
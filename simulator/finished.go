@@ -0,0 +1,88 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// PacketStats sums up the packets whose records were dropped once nothing
+// could happen to them anymore.
+type PacketStats struct {
+	PacketCounts
+	Fees   float64 // fees paid to relay the packets
+	MaxFee float64
+
+	Latencies map[string]LatencyDist // delivered packets by destination
+	Routes    map[string][]string    // routes taken, the source chain first
+	Bounds    []time.Time            // send times the packets are split at
+	Windows   []PacketTally          // packets sent between bounds
+}
+
+func (f *PacketStats) add(p *Packet) {
+	f.PacketCounts.add(p)
+	f.Fees += p.Cost.Fee
+	if p.Cost.Fee > f.MaxFee {
+		f.MaxFee = p.Cost.Fee
+	}
+
+	if p.Delivered {
+		if _, ok := f.Latencies[p.Dst]; !ok {
+			f.Latencies[p.Dst] = make(LatencyDist)
+		}
+		f.Latencies[p.Dst][p.Latency()]++
+	}
+
+	route := append([]string{p.Src}, p.Hops...)
+	f.Routes[strings.Join(route, ">")] = route
+
+	i := sort.Search(len(f.Bounds), func(i int) bool { return f.Bounds[i].After(p.SentAt) })
+	f.Windows[i].add(p)
+}
+
+func (t *PacketTally) merge(other PacketTally) {
+	t.Count += other.Count
+	t.Delivered += other.Delivered
+	t.Total += other.Total
+	if other.Max > t.Max {
+		t.Max = other.Max
+	}
+}
+
+// DropFinished drops the record of every packet once it is delivered and
+// acknowledged, lost or timed out, so that the packets in flight are all
+// that is kept. What the reports need is summed up in Finished instead.
+// Packets can only be tallied by send time between the given bounds. When
+// finished packets are already dropped, the bounds are added to the others
+// and must not be before the current time.
+func (s *State) DropFinished(bounds []time.Time) {
+	if s.Finished == nil {
+		s.Finished = &PacketStats{
+			Latencies: make(map[string]LatencyDist),
+			Routes:    make(map[string][]string),
+			Windows:   make([]PacketTally, 1),
+		}
+	}
+
+	f := s.Finished
+	for _, b := range bounds {
+		i := sort.Search(len(f.Bounds), func(i int) bool { return !f.Bounds[i].Before(b) })
+		if i < len(f.Bounds) && f.Bounds[i].Equal(b) {
+			continue
+		}
+
+		// Every packet summed up so far was sent before the bound
+		f.Bounds = append(f.Bounds[:i], append([]time.Time{b}, f.Bounds[i:]...)...)
+		f.Windows = append(f.Windows[:i+1], append([]PacketTally{{}}, f.Windows[i+1:]...)...)
+	}
+}
+
+// finishPacket sums up and drops the record of a packet that nothing can
+// happen to anymore, when finished packets are dropped.
+func (s *State) finishPacket(p *Packet) {
+	if s.Finished == nil {
+		return
+	}
+	s.Finished.add(p)
+	delete(s.Packets, p.ID)
+}
@@ -0,0 +1,57 @@
+package simulator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Dropping finished packets leaves only those in flight and gives the same
+// summary, latencies and tallies as keeping them all
+func TestDropFinished(t *testing.T) {
+	kept, kept_ctx := newTestQueue(30)
+	dropped, dropped_ctx := newTestQueue(30)
+	ks, ds := kept.BatonState, dropped.BatonState
+	ds.DropFinished([]time.Time{ds.Start.Add(10 * time.Second)})
+
+	runUntil(kept, kept_ctx, ks.Start.Add(15*time.Second))
+	runUntil(dropped, dropped_ctx, ds.Start.Add(15*time.Second))
+	if len(ds.Packets) >= len(ks.Packets) {
+		t.Fatalf("%d packets kept while dropping, %d without", len(ds.Packets), len(ks.Packets))
+	}
+	if got, want := ds.Frame(ds.Time), ks.Frame(ks.Time); !reflect.DeepEqual(got, want) {
+		t.Fatalf("frame while dropping is %+v, want %+v", got, want)
+	}
+
+	want := finish(kept, kept_ctx)
+	if got := finish(dropped, dropped_ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dropping packets gave %v, want %v", got, want)
+	}
+	if len(ds.Packets) != 0 {
+		t.Fatalf("%d finished packets were kept", len(ds.Packets))
+	}
+
+	if got, want := ds.LatenciesByDst(), ks.LatenciesByDst(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("latencies are %v, want %v", got, want)
+	}
+	if got, want := ds.PacketRoutes(), ks.PacketRoutes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("routes are %v, want %v", got, want)
+	}
+
+	// Tallies before the bound, after it and of all packets
+	for _, side := range []int{-1, 1, 0} {
+		tally := func(s *State) PacketTally {
+			bound := s.Start.Add(10 * time.Second)
+			switch side {
+			case -1:
+				return s.TallyPackets(time.Time{}, bound)
+			case 1:
+				return s.TallyPackets(bound, time.Time{})
+			}
+			return s.TallyPackets(time.Time{}, time.Time{})
+		}
+		if got, want := tally(ds), tally(ks); got != want {
+			t.Fatalf("tally %d is %+v, want %+v", side, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package simulator
+
+const (
+	MSG_UPDATE  = 0 // client update
+	MSG_RECV    = 1 // packet receive
+	MSG_ACK     = 2 // packet acknowledgement
+	MSG_TIMEOUT = 3 // packet timeout
+	MSG_CUSTOM  = 4 // message submitted by a custom event type
+	NUM_MSGS    = 5
+)
+
+var msgNames = [NUM_MSGS]string{"update", "recv", "ack", "timeout", "custom"}
+
+func MsgName(kind uint32) string {
+	if kind >= NUM_MSGS {
+		return "unknown"
+	}
+	return msgNames[kind]
+}
+
+// MsgKind returns the message type with the given name.
+func MsgKind(name string) (uint32, bool) {
+	for kind, n := range msgNames {
+		if n == name {
+			return uint32(kind), true
+		}
+	}
+	return 0, false
+}
+
+// ChainPrice gives the gas price of a chain in its native fee token,
+// and the value of the native token in a common unit.
+type ChainPrice struct {
+	GasPrice float64
+	UnitRate float64
+}
+
+// GasSchedule gives the gas used by each message type and the gas price of each chain.
+type GasSchedule struct {
+	Gas          [NUM_MSGS]uint64
+	TxGas        uint64 // gas used by every transaction regardless of its messages
+	Prices       map[string]ChainPrice
+	DefaultPrice ChainPrice
+}
+
+func NewGasSchedule() *GasSchedule {
+	return &GasSchedule{
+		Gas: [NUM_MSGS]uint64{
+			MSG_UPDATE:  300000,
+			MSG_RECV:    150000,
+			MSG_ACK:     100000,
+			MSG_TIMEOUT: 120000,
+			MSG_CUSTOM:  200000,
+		},
+		Prices:       make(map[string]ChainPrice),
+		DefaultPrice: ChainPrice{GasPrice: 0.025, UnitRate: 1},
+	}
+}
+
+func (g *GasSchedule) Price(chain_id string) ChainPrice {
+	if p, ok := g.Prices[chain_id]; ok {
+		return p
+	}
+	return g.DefaultPrice
+}
+
+// Cost accumulates the gas and fees paid for messages.
+type Cost struct {
+	Msgs int
+	Gas  uint64
+	Fee  float64 // in the common unit
+}
+
+func (c *Cost) add(gas uint64, fee float64) {
+	c.Msgs++
+	c.Gas += gas
+	c.Fee += fee
+}
+
+// RelayerID returns the relayer that serves the connection between two chains.
+// Every connection is assumed to be served by its own relayer.
+func RelayerID(a, b string) string {
+	return ConnectionKey(a, b)
+}
+
+// recordMsg books a message relayed by the relayer onto the chain. The message
+// takes up block space and its fee is charged to the chain, relayer and packet.
+// Wasted messages failed but were still paid for.
+func (s *State) recordMsg(chain *Chain, kind uint32, relayer string, packet uint64, wasted bool) {
+	chain.IncreaseMsgCount(kind)
+	if wasted {
+		chain.IncreaseWastedTx()
+	}
+
+	gas := s.Gas.Gas[kind]
+	if !s.addToBatch(chain, relayer) {
+		chain.IncreaseTxCount()
+		gas += s.Gas.TxGas
+	}
+
+	price := s.Gas.Price(chain.GetID())
+	native_fee := float64(gas) * price.GasPrice
+	fee := native_fee * price.UnitRate
+
+	chain.gas_used += gas
+	chain.native_fees += native_fee
+	chain.fees += fee
+
+	if _, ok := s.RelayerCosts[relayer]; !ok {
+		s.RelayerCosts[relayer] = &Cost{}
+	}
+	s.RelayerCosts[relayer].add(gas, fee)
+
+	if p, ok := s.Packets[packet]; ok {
+		p.Cost.add(gas, fee)
+	}
+}
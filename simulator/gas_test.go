@@ -0,0 +1,60 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+)
+
+// Messages are charged their gas, and every transaction its transaction gas,
+// at the gas price of the chain they land on
+func TestRecordMsgCosts(t *testing.T) {
+	q, _ := newTestQueue(0)
+	state := q.BatonState
+	state.Gas.TxGas = 50000
+	state.Gas.Prices["b"] = ChainPrice{GasPrice: 0.5, UnitRate: 2}
+	state.Packets[1] = &Packet{ID: 1, Src: "a", Dst: "b"}
+
+	a, b := state.Chains["a"], state.Chains["b"]
+	relayer := RelayerID("a", "b")
+	state.recordMsg(b, MSG_UPDATE, relayer, 1, false)
+	state.recordMsg(b, MSG_RECV, relayer, 1, false)
+	state.recordMsg(a, MSG_ACK, relayer, 1, true)
+
+	if got, want := b.GasUsed(), uint64(300000+150000+2*50000); got != want {
+		t.Fatalf("b used %d gas, want %d", got, want)
+	}
+	if got, want := b.NativeFees(), 0.5*float64(b.GasUsed()); got != want {
+		t.Fatalf("b was paid %v in its token, want %v", got, want)
+	}
+	if got, want := b.Fees(), 2*b.NativeFees(); got != want {
+		t.Fatalf("b was paid %v, want %v", got, want)
+	}
+	if got, want := a.Fees(), 0.025*150000; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("a was paid %v, want %v", got, want)
+	}
+	if a.WastedTx() != 1 || b.WastedTx() != 0 {
+		t.Fatalf("%d and %d wasted transactions on a and b", a.WastedTx(), b.WastedTx())
+	}
+
+	cost := state.RelayerCosts[relayer]
+	if cost.Msgs != 3 || cost.Gas != b.GasUsed()+a.GasUsed() || cost.Fee != a.Fees()+b.Fees() {
+		t.Fatalf("relayer cost is %+v", cost)
+	}
+	if p := state.Packets[1]; p.Cost != *cost {
+		t.Fatalf("packet cost is %+v, want %+v", p.Cost, *cost)
+	}
+}
+
+func TestGasPrice(t *testing.T) {
+	g := NewGasSchedule()
+	g.Prices["a"] = ChainPrice{GasPrice: 1, UnitRate: 3}
+	if got := g.Price("a"); got != g.Prices["a"] {
+		t.Fatalf("price of a is %+v", got)
+	}
+	if got := g.Price("b"); got != g.DefaultPrice {
+		t.Fatalf("price of b is %+v, want the default %+v", got, g.DefaultPrice)
+	}
+	if kind, ok := MsgKind("timeout"); !ok || kind != MSG_TIMEOUT || MsgName(kind) != "timeout" {
+		t.Fatalf("timeout messages are kind %d", kind)
+	}
+}
@@ -0,0 +1,61 @@
+package simulator
+
+// Observer watches a simulation as it runs. Observers are called synchronously
+// by the queue, in the order they were added, and must not block. Embed
+// BaseObserver to only implement the hooks that are needed.
+type Observer interface {
+	// BeforeEvent is called right before an event runs
+	BeforeEvent(sim *Sim, e Event)
+	// AfterEvent is called right after an event ran
+	AfterEvent(sim *Sim, e Event)
+	// OnEnqueue is called when an event is added to the queue
+	OnEnqueue(sim *Sim, e Event)
+	// OnHeight is called when a chain produces a block
+	OnHeight(sim *Sim, chain *Chain)
+	// OnDelivery is called when a packet reaches its destination
+	OnDelivery(sim *Sim, p *Packet)
+}
+
+// BaseObserver implements every hook of Observer without doing anything.
+type BaseObserver struct{}
+
+func (BaseObserver) BeforeEvent(sim *Sim, e Event)   {}
+func (BaseObserver) AfterEvent(sim *Sim, e Event)    {}
+func (BaseObserver) OnEnqueue(sim *Sim, e Event)     {}
+func (BaseObserver) OnHeight(sim *Sim, chain *Chain) {}
+func (BaseObserver) OnDelivery(sim *Sim, p *Packet)  {}
+
+// AddObserver adds an observer to the queue.
+func (q *EventQueue) AddObserver(o Observer) {
+	q.observers = append(q.observers, o)
+}
+
+// RemoveObserver removes an observer from the queue.
+func (q *EventQueue) RemoveObserver(o Observer) {
+	for i, other := range q.observers {
+		if other == o {
+			q.observers = append(q.observers[:i:i], q.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Observers of the queue running the state, if any
+func (s *State) observers() []Observer {
+	if s.queue == nil {
+		return nil
+	}
+	return s.queue.observers
+}
+
+func (s *State) heightChanged(chain *Chain) {
+	for _, o := range s.observers() {
+		o.OnHeight(s.Sim(), chain)
+	}
+}
+
+func (s *State) packetDelivered(p *Packet) {
+	for _, o := range s.observers() {
+		o.OnDelivery(s.Sim(), p)
+	}
+}
@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+// Counts every hook and checks that events run between their hooks
+type countingObserver struct {
+	t        *testing.T
+	name     string
+	log      *[]string
+	running  Event
+	before   int
+	after    int
+	enqueued int
+	heights  int
+	delivers int
+}
+
+func (o *countingObserver) BeforeEvent(sim *Sim, e Event) {
+	if o.running != nil {
+		o.t.Fatalf("event %v started while %v runs", e, o.running)
+	}
+	o.running = e
+	o.before++
+	*o.log = append(*o.log, o.name)
+}
+
+func (o *countingObserver) AfterEvent(sim *Sim, e Event) {
+	if o.running != e {
+		o.t.Fatalf("event %v ended while %v runs", e, o.running)
+	}
+	o.running = nil
+	o.after++
+}
+
+func (o *countingObserver) OnEnqueue(sim *Sim, e Event)     { o.enqueued++ }
+func (o *countingObserver) OnHeight(sim *Sim, chain *Chain) { o.heights++ }
+func (o *countingObserver) OnDelivery(sim *Sim, p *Packet)  { o.delivers++ }
+
+func TestObservers(t *testing.T) {
+	q := NewEventQueue()
+	state := q.BatonState
+	state.Log = nil
+	state.Rand = NewRand(1)
+	for _, id := range []string{"a", "b", "c"} {
+		state.AddChain(NewChain(id))
+	}
+	state.OpenConnection("a", "b")
+	state.OpenConnection("b", "c")
+	q.Init()
+
+	var log []string
+	first := &countingObserver{t: t, name: "first", log: &log}
+	second := &countingObserver{t: t, name: "second", log: &log}
+	removed := &countingObserver{t: t, name: "removed", log: &log}
+	q.AddObserver(first)
+	q.AddObserver(removed)
+	q.AddObserver(second)
+	q.RemoveObserver(removed)
+
+	for i := 0; i < 10; i++ {
+		q.AddEventToLoad(NewSendEvent(state.Start.Add(time.Duration(i)*time.Second), "a", "c"))
+	}
+	q.LoadEventsIntoQueue()
+	for q.Step(NewContext(state, false, nil)) == nil {
+	}
+
+	ran := first.before
+	if ran == 0 || first.after != ran || first.enqueued != ran {
+		t.Fatalf("%d events started, %d ended and %d enqueued", ran, first.after, first.enqueued)
+	}
+	heights := 0
+	for _, ch := range state.Chains {
+		heights += int(ch.GetHeight())
+	}
+	if first.heights != heights || first.delivers != state.CountPackets().Delivered {
+		t.Fatalf("%d blocks and %d deliveries observed, want %d and %d", first.heights, first.delivers, heights, state.CountPackets().Delivered)
+	}
+	if *second != (countingObserver{t: t, name: "second", log: &log, before: ran, after: ran, enqueued: ran, heights: heights, delivers: first.delivers}) {
+		t.Fatalf("observers saw different runs: %+v and %+v", first, second)
+	}
+	if removed.before != 0 || removed.enqueued != 0 {
+		t.Fatalf("removed observer was called")
+	}
+	for i := 0; i < len(log); i += 2 {
+		if log[i] != "first" || log[i+1] != "second" {
+			t.Fatalf("observers called out of order: %v", log[i:i+2])
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Packet tracks a single packet from the moment it is sent until
+// it is delivered to its destination chain.
+type Packet struct {
+	ID          uint64
+	Src         string
+	Dst         string
+	Hops        []string // chain hops not including the source chain
+	SentAt      time.Time
+	DeliveredAt time.Time
+	Delivered   bool
+	Lost        bool
+	TimedOut    bool
+	Acked       bool
+	Attempts    int  // failed submissions made for the packet
+	Cost        Cost // fees paid to relay the packet
+}
+
+func (p *Packet) Latency() time.Duration {
+	if !p.Delivered {
+		return 0
+	}
+	return p.DeliveredAt.Sub(p.SentAt)
+}
+
+// PrevHop returns the chain before the given chain on the packet's route.
+// Returns the source chain if the chain is not on the route.
+func (p *Packet) PrevHop(chain_id string) string {
+	prev := p.Src
+	for _, hop := range p.Hops {
+		if hop == chain_id {
+			return prev
+		}
+		prev = hop
+	}
+	return p.Src
+}
+
+// NewPacket registers a packet sent at time t from the source chain along the given hops.
+func (s *State) NewPacket(t time.Time, src string, hops []string) *Packet {
+	s.packet_seq++
+	p := &Packet{ID: s.packet_seq, Src: src, Dst: hops[len(hops)-1], Hops: hops, SentAt: t}
+	s.Packets[p.ID] = p
+	return p
+}
+
+// MarkDelivered records that the packet reached the given chain at time t.
+// Packets are only considered delivered once they reach their destination.
+func (s *State) MarkDelivered(id uint64, chain_id string, t time.Time) {
+	p, ok := s.Packets[id]
+	if !ok || p.Dst != chain_id || p.Delivered {
+		return
+	}
+	p.Delivered = true
+	p.DeliveredAt = t
+	s.packetDelivered(p)
+}
+
+// PacketCounts counts the packets sent by outcome.
+type PacketCounts struct {
+	Sent      int
+	Delivered int
+	Lost      int
+	TimedOut  int
+}
+
+func (c *PacketCounts) add(p *Packet) {
+	c.Sent++
+	if p.Delivered {
+		c.Delivered++
+	}
+	if p.Lost {
+		c.Lost++
+	}
+	if p.TimedOut {
+		c.TimedOut++
+	}
+}
+
+// CountPackets counts every packet sent so far by outcome.
+func (s *State) CountPackets() PacketCounts {
+	var c PacketCounts
+	if s.Finished != nil {
+		c = s.Finished.PacketCounts
+	}
+	for _, p := range s.Packets {
+		c.add(p)
+	}
+	return c
+}
+
+// PacketTally counts packets and sums up the latency of those delivered.
+type PacketTally struct {
+	Count     int
+	Delivered int
+	Total     time.Duration
+	Max       time.Duration
+}
+
+func (t *PacketTally) add(p *Packet) {
+	t.Count++
+	if !p.Delivered {
+		return
+	}
+	t.Delivered++
+	t.Total += p.Latency()
+	if p.Latency() > t.Max {
+		t.Max = p.Latency()
+	}
+}
+
+// Mean latency of the delivered packets
+func (t PacketTally) Mean() time.Duration {
+	if t.Delivered == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Delivered)
+}
+
+// TallyPackets tallies the packets sent from time from up to time to. A zero
+// time leaves that side open. When finished packets are dropped, the times
+// must be among the bounds given to DropFinished.
+func (s *State) TallyPackets(from time.Time, to time.Time) PacketTally {
+	var t PacketTally
+	if f := s.Finished; f != nil {
+		for i, w := range f.Windows {
+			// Window i holds the packets sent from bound i-1 up to bound i
+			after := from.IsZero() || i > 0 && !f.Bounds[i-1].Before(from)
+			before := to.IsZero() || i < len(f.Bounds) && !f.Bounds[i].After(to)
+			if after && before {
+				t.merge(w)
+			}
+		}
+	}
+	for _, p := range s.Packets {
+		if (from.IsZero() || !p.SentAt.Before(from)) && (to.IsZero() || p.SentAt.Before(to)) {
+			t.add(p)
+		}
+	}
+	return t
+}
+
+// PacketFees returns the fees paid to relay all packets and the most paid for one.
+func (s *State) PacketFees() (total float64, max float64) {
+	if s.Finished != nil {
+		total, max = s.Finished.Fees, s.Finished.MaxFee
+	}
+	for _, p := range s.Packets {
+		total += p.Cost.Fee
+		if p.Cost.Fee > max {
+			max = p.Cost.Fee
+		}
+	}
+	return total, max
+}
+
+// PacketRoutes returns the distinct routes packets were sent over, the
+// source chain first.
+func (s *State) PacketRoutes() [][]string {
+	routes := make(map[string][]string)
+	if s.Finished != nil {
+		for key, route := range s.Finished.Routes {
+			routes[key] = route
+		}
+	}
+	for _, p := range s.Packets {
+		route := append([]string{p.Src}, p.Hops...)
+		routes[strings.Join(route, ">")] = route
+	}
+
+	keys := make([]string, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	retval := make([][]string, len(keys))
+	for i, key := range keys {
+		retval[i] = routes[key]
+	}
+	return retval
+}
@@ -0,0 +1,90 @@
+package simulator
+
+import "time"
+
+// Pacer holds events back until they are due on the wall clock, so that a
+// run plays out in real time. Speed is the simulated time that passes per
+// unit of wall clock time. A pacer with a speed of 0 or less never waits.
+type Pacer struct {
+	Speed float64
+
+	started bool
+	sim     time.Time // simulated time at which pacing started
+	wall    time.Time // wall clock time at which pacing started
+}
+
+func NewPacer(speed float64) *Pacer {
+	return &Pacer{Speed: speed}
+}
+
+// Wait sleeps until the simulated time t is due, or until cancel is closed.
+// The first time waited for is due immediately. A nil cancel never ends the
+// wait early. Returns false if the wait was cancelled.
+func (p *Pacer) Wait(t time.Time, cancel <-chan struct{}) bool {
+	if p.Speed <= 0 {
+		return true
+	}
+	if !p.started {
+		p.sim, p.wall, p.started = t, time.Now(), true
+		return true
+	}
+
+	due := p.wall.Add(time.Duration(float64(t.Sub(p.sim)) / p.Speed))
+	d := time.Until(due)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// ChainFrame is the state of a chain in a frame.
+type ChainFrame struct {
+	ID      string `json:"id"`
+	Height  uint64 `json:"height"`
+	BlockTx int    `json:"block_tx"`
+	TotalTx int    `json:"total_tx"`
+	MaxTx   int    `json:"max_tx"`
+}
+
+// Frame is a small snapshot of a running simulation, meant to be shown live.
+type Frame struct {
+	TimeMs    float64      `json:"time_ms"` // since the start of the simulation
+	Pending   int          `json:"pending"` // events waiting in the queue
+	Sent      int          `json:"sent"`
+	Delivered int          `json:"delivered"`
+	Lost      int          `json:"lost"`
+	TimedOut  int          `json:"timed_out"`
+	Chains    []ChainFrame `json:"chains"`
+}
+
+// Frame takes a frame of the state at time t.
+func (s *State) Frame(t time.Time) Frame {
+	packets := s.CountPackets()
+	f := Frame{
+		Sent:      packets.Sent,
+		Delivered: packets.Delivered,
+		Lost:      packets.Lost,
+		TimedOut:  packets.TimedOut,
+		Chains:    make([]ChainFrame, 0, len(s.Chains)),
+	}
+	if t.After(s.Start) {
+		f.TimeMs = float64(t.Sub(s.Start)) / float64(time.Millisecond)
+	}
+	if s.queue != nil {
+		f.Pending = s.queue.Len()
+	}
+
+	for _, id := range s.ChainIDs() {
+		if ch, ok := s.Chains[id]; ok {
+			f.Chains = append(f.Chains, ChainFrame{id, ch.GetHeight(), ch.TxCount(), ch.TotalTx(), ch.GetMaxTxCount()})
+		}
+	}
+	return f
+}
@@ -0,0 +1,50 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacerWait(t *testing.T) {
+	start := time.Time{}
+	p := NewPacer(1000)
+	if !p.Wait(start, nil) {
+		t.Fatalf("the first wait was cancelled")
+	}
+
+	// 20s of simulated time take 20ms at a speed of 1000
+	began := time.Now()
+	if !p.Wait(start.Add(20*time.Second), nil) {
+		t.Fatalf("an uncancellable wait was cancelled")
+	}
+	if waited := time.Since(began); waited < 15*time.Millisecond {
+		t.Fatalf("waited %v, want about 20ms", waited)
+	}
+
+	// Times already due do not wait
+	began = time.Now()
+	p.Wait(start.Add(time.Second), nil)
+	if waited := time.Since(began); waited > 5*time.Millisecond {
+		t.Fatalf("waited %v for a time already due", waited)
+	}
+}
+
+// Closing the cancel channel ends a wait at once
+func TestPacerCancel(t *testing.T) {
+	start := time.Time{}
+	p := NewPacer(1)
+	p.Wait(start, nil)
+
+	cancel := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(cancel)
+	}()
+	began := time.Now()
+	if p.Wait(start.Add(time.Hour), cancel) {
+		t.Fatalf("a cancelled wait ran to the end")
+	}
+	if waited := time.Since(began); waited > time.Second {
+		t.Fatalf("the wait took %v to be cancelled", waited)
+	}
+}
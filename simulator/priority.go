@@ -0,0 +1,43 @@
+package simulator
+
+import "fmt"
+
+// Priority classes order the events that happen at the same time. Events run
+// by time, then by class, and events of the same class in the order they were
+// scheduled, numbered by State.Seq. Runs with the same inputs therefore run
+// their events in the same order, whatever the queue.
+//
+// At any instant, faults and topology changes take effect first, so that a
+// chain halted at t does not produce a block at t. Blocks are produced next:
+// a block produced at t closes the block open until then, and transactions
+// submitted at t, such as client updates, deliveries and acknowledgements,
+// are included in the new block. Timeouts come last, so a packet delivered at
+// the instant it would time out is delivered.
+const (
+	PRIORITY_NETWORK = 0 // faults and topology changes
+	PRIORITY_BLOCK   = 1 // block production
+	PRIORITY_TX      = 2 // sends and relayed transactions. The default for custom events
+	PRIORITY_TIMEOUT = 3 // packet timeouts
+)
+
+// SetEventPriority sets the priority class of a custom event type.
+func SetEventPriority(id uint64, priority int) error {
+	et, ok := eventTypes[id]
+	if !ok || id < FIRST_CUSTOM_EVENT_TYPE {
+		return fmt.Errorf("event type %d is not a registered custom event type", id)
+	}
+	if priority < PRIORITY_NETWORK || priority > PRIORITY_TIMEOUT {
+		return fmt.Errorf("unknown priority class %d", priority)
+	}
+	et.Priority = priority
+	return nil
+}
+
+// Returns the priority class of events of a type. Events of unregistered
+// types are transactions.
+func eventPriority(kind uint64) int {
+	if et, ok := eventTypes[kind]; ok {
+		return et.Priority
+	}
+	return PRIORITY_TX
+}
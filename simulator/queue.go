@@ -7,11 +7,65 @@ import (
 )
 
 var MainEventQueue EventQueue
-var EventLoader EventHeap
 
-// Event Heap
+// EventLoader holds the events waiting to be loaded into the main event queue.
+//
+// Deprecated: use AddEventToLoad and LoadEventsIntoQueue.
+var EventLoader = Loader{queue: &MainEventQueue}
+
+// Loader gives access to the events waiting to be loaded into a queue, in
+// the order they will run.
+type Loader struct {
+	queue *EventQueue
+}
+
+// Insert adds an event to load, without its sub events.
+func (l Loader) Insert(event Event) {
+	l.queue.loader = append(l.queue.loader, queued{at: event.Time().UnixNano(), event: event})
+}
+
+// Position of the first event to run, -1 if there are none
+func (l Loader) first() int {
+	first := -1
+	for i, x := range l.queue.loader {
+		if first < 0 || x.at < l.queue.loader[first].at {
+			first = i
+		}
+	}
+	return first
+}
+
+// Top returns the first event to run without removing it, nil if there are none.
+func (l Loader) Top() Event {
+	i := l.first()
+	if i < 0 {
+		return nil
+	}
+	return l.queue.loader[i].event
+}
+
+// Pop removes and returns the first event to run, nil if there are none.
+func (l Loader) Pop() Event {
+	i := l.first()
+	if i < 0 {
+		return nil
+	}
+	event := l.queue.loader[i].event
+	l.queue.loader = append(l.queue.loader[:i], l.queue.loader[i+1:]...)
+	return event
+}
+
+// Len returns the number of events waiting to be loaded.
+func (l Loader) Len() int {
+	return len(l.queue.loader)
+}
+
+// Event Heap. Events are ordered by time, and events at the same time in
+// the order they were inserted.
 type EventHeap struct {
 	heap []Event
+	seqs []uint64 // insertion order of the events in heap
+	next uint64
 }
 
 func NewEventHeap() *EventHeap {
@@ -44,54 +98,50 @@ func (eh *EventHeap) right(i int) int {
 	return i*2 + 2
 }
 
-func (eh *EventHeap) bubbleUp(i int) {
-	if i >= len(eh.heap) {
-		return
+func (eh *EventHeap) less(i, j int) bool {
+	ti, tj := eh.heap[i].Time(), eh.heap[j].Time()
+	if !ti.Equal(tj) {
+		return ti.Before(tj)
 	}
+	return eh.seqs[i] < eh.seqs[j]
+}
 
-	parent := eh.parent(i)
-	if parent < 0 {
+func (eh *EventHeap) swap(i, j int) {
+	eh.heap[i], eh.heap[j] = eh.heap[j], eh.heap[i]
+	eh.seqs[i], eh.seqs[j] = eh.seqs[j], eh.seqs[i]
+}
+
+func (eh *EventHeap) bubbleUp(i int) {
+	if i >= len(eh.heap) {
 		return
 	}
 
-	for eh.heap[parent].Time().After(eh.heap[i].Time()) {
-		tmp := eh.heap[i]
-		eh.heap[i] = eh.heap[parent]
-		eh.heap[parent] = tmp
-
+	for i > 0 {
+		parent := eh.parent(i)
+		if !eh.less(i, parent) {
+			break
+		}
+		eh.swap(i, parent)
 		i = parent
-		parent = eh.parent(i)
 	}
 }
 
 func (eh *EventHeap) bubbleDown(i int) {
-	heap_len := len(eh.heap)
-
-	if i > heap_len {
-		return
-	}
-
 	left, right := eh.left(i), eh.right(i)
 
 	// Child exists
-	for !(left < 0 && right < 0) {
-		var min_event Event
+	for left >= 0 {
 		min_index := left
-		if left < 0 || (right > 0 && eh.heap[left].Time().After(eh.heap[right].Time())) {
+		if right >= 0 && eh.less(right, left) {
 			min_index = right
-			min_event = eh.heap[right]
-		} else {
-			min_event = eh.heap[left]
 		}
 
 		// no smaller child
-		if eh.heap[i].Time().Before(min_event.Time()) {
+		if !eh.less(min_index, i) {
 			break
 		}
 
-		tmp := eh.heap[min_index]
-		eh.heap[min_index] = eh.heap[i]
-		eh.heap[i] = tmp
+		eh.swap(i, min_index)
 		i = min_index
 		left, right = eh.left(i), eh.right(i)
 	}
@@ -99,6 +149,8 @@ func (eh *EventHeap) bubbleDown(i int) {
 
 func (eh *EventHeap) Insert(event Event) {
 	eh.heap = append(eh.heap, event)
+	eh.seqs = append(eh.seqs, eh.next)
+	eh.next++
 	eh.bubbleUp(len(eh.heap) - 1)
 }
 
@@ -115,15 +167,12 @@ func (eh *EventHeap) Pop() Event {
 		return nil
 	}
 
-	// fmt.Printf("HEAP POP: ")
-	// for _, e := range eh.heap {
-	// 	fmt.Printf("%v ", e.Time())
-	// }
-	// fmt.Printf("\n\n")
-
 	top := eh.heap[0]
-	eh.heap[0] = eh.heap[len(eh.heap)-1]
-	eh.heap = eh.heap[:len(eh.heap)-1]
+	last := len(eh.heap) - 1
+	eh.swap(0, last)
+	eh.heap[last] = nil
+	eh.heap = eh.heap[:last]
+	eh.seqs = eh.seqs[:last]
 	eh.bubbleDown(0)
 
 	return top
@@ -138,101 +187,231 @@ func (eh *EventHeap) Find(this_event Event, cmp func(Event, Event) bool) (Event,
 	return nil, -1
 }
 
+// Update restores the order after the time of the event at index changed
 func (eh *EventHeap) Update(index int) {
 	// Check whether to bubble up or down
 	parent := eh.parent(index)
-	if parent < 0 || eh.heap[parent].Time().Before(eh.heap[index].Time()) {
-		eh.bubbleDown(index)
+	if index > 0 && eh.less(index, parent) {
+		eh.bubbleUp(index)
 		return
 	}
-	eh.bubbleUp(index)
+	eh.bubbleDown(index)
 }
 
 // Event Queue
 type EventQueue struct {
-	queue *EventHeap
+	queue   schedule
+	loader  []queued // events waiting to be loaded into the queue
+	sources []Source // nil once a source has no more events
+
+	implicit_started bool
+	implicit_pending bool      // the next implicit event is in the queue
+	implicit_timer   time.Time // time of the last implicit event
+	horizon          time.Time // time of the last event loaded or pulled from a source
 
 	BatonState *State
+	Trace      *EventWriter // if set, every event is written to it before it runs
+
+	observers []Observer
 }
 
+// NewQueue creates the main event queue used by the package level
+// loading functions.
 func NewQueue() *EventQueue {
-	MainEventQueue = EventQueue{queue: &EventHeap{}, BatonState: NewState()}
-	EventLoader = EventHeap{}
+	MainEventQueue = EventQueue{queue: &timeHeap{}, BatonState: NewState()}
+	MainEventQueue.BatonState.queue = &MainEventQueue
 	return &MainEventQueue
 }
 
+// NewEventQueue creates an event queue with its own state, independent of
+// the main event queue. Several of these can run at the same time.
+func NewEventQueue() *EventQueue {
+	q := &EventQueue{queue: &timeHeap{}, BatonState: NewState()}
+	q.BatonState.queue = q
+	return q
+}
+
+// UseCalendarQueue keeps the events in a calendar queue instead of a heap.
+// Events run in the same order either way. Calendar queues are faster for
+// large queues of evenly spread events.
+func (e *EventQueue) UseCalendarQueue() {
+	if _, ok := e.queue.(*calendarQueue); ok {
+		return
+	}
+	c := newCalendarQueue()
+	c.load(e.queue.all())
+	e.queue = c
+}
+
+// Calendar returns whether the events are kept in a calendar queue.
+func (e *EventQueue) Calendar() bool {
+	_, ok := e.queue.(*calendarQueue)
+	return ok
+}
+
 // Should be called after adding all chains
 func (e *EventQueue) Init() {
 	e.BatonState.InitializeImplicitEvents()
 }
 
+// Gives the event its place in the queue, after the events scheduled before it
+func (e *EventQueue) entry(event Event, loaded bool) queued {
+	e.BatonState.Seq++
+	return e.entryAt(event, e.BatonState.Seq, loaded)
+}
+
+func (e *EventQueue) entryAt(event Event, seq uint64, loaded bool) queued {
+	return queued{at: event.Time().UnixNano(), seq: seq, event: event, priority: uint8(eventPriority(event.Type())), loaded: loaded}
+}
+
 func (e *EventQueue) Enqueue(event Event) {
-	e.queue.Insert(event)
+	e.queue.push(e.entry(event, false))
+	for _, o := range e.observers {
+		o.OnEnqueue(e.BatonState.Sim(), event)
+	}
+}
+
+// Len returns the number of events waiting in the queue.
+func (e *EventQueue) Len() int {
+	return e.queue.len()
+}
+
+// Next returns the next event to run without removing it. Returns nil if the queue is empty.
+func (e *EventQueue) Next() Event {
+	next, _ := e.queue.top()
+	return next.event
+}
+
+// Events waiting in the queue, in the order they will run
+func (e *EventQueue) pending() []queued {
+	pending := append([]queued{}, e.queue.all()...)
+	sortQueued(pending)
+	return pending
+}
+
+// Pending returns the events waiting in the queue, in the order they will run.
+func (e *EventQueue) Pending() []Event {
+	pending := make([]Event, 0, e.queue.len())
+	for _, x := range e.pending() {
+		pending = append(pending, x.event)
+	}
+	return pending
 }
 
 func (e *EventQueue) Step(ctx context.Context) error {
-	event := e.queue.Pop()
-	if event == nil {
+	next, ok := e.queue.pop()
+	if !ok {
 		return errors.New("empty")
 	}
+	event := next.event
+	if next.implicit {
+		e.implicit_pending = false
+		e.scheduleImplicit()
+	}
+	if next.source > 0 {
+		e.pull(int(next.source) - 1)
+	}
 
 	e.BatonState.Time = event.Time()
+	if e.Trace != nil {
+		// Events that were not loaded are created by the simulation
+		if next.loaded {
+			e.Trace.Write(event)
+		} else {
+			e.Trace.WriteDerived(event)
+		}
+	}
+	for _, o := range e.observers {
+		o.BeforeEvent(e.BatonState.Sim(), event)
+	}
 	event.Execute(ctx)
+	if event.Type() >= FIRST_CUSTOM_EVENT_TYPE {
+		e.BatonState.countEvent(event.Type())
+	}
+	for _, o := range e.observers {
+		o.AfterEvent(e.BatonState.Sim(), event)
+	}
 
 	return nil
 }
 
 // Add & Load events
 func AddEventToLoad(event Event) {
-	EventLoader.Insert(event)
-	event.AddMsg()
+	MainEventQueue.AddEventToLoad(event)
+}
+
+func (q *EventQueue) AddEventToLoad(event Event) {
+	q.loader = append(q.loader, queued{at: event.Time().UnixNano(), event: event})
 
 	// Load sub events
 	sub_events := event.SubEvents()
 	for _, e := range sub_events {
-		AddEventToLoad(e)
+		q.AddEventToLoad(e)
 	}
 }
 
-// LoadEventsIntoQueue will load all the events added to the
-// event loader into the event queue. This function will
-// also add any necessary implicit event. For example, this
-// will add events to increment the height of each blockchain.
+// LoadEventsIntoQueue loads the events added to the main event queue's loader.
 func LoadEventsIntoQueue() error {
-	var implicit_timer time.Time
-	started := false
+	return MainEventQueue.LoadEventsIntoQueue()
+}
 
-	for {
-		event := EventLoader.Pop()
-		if event == nil {
-			// Check in case empty
-			break
-		}
+// LoadEventsIntoQueue will load all the events added to the
+// event loader into the event queue. This function will
+// also start the implicit events, from the first event loaded or
+// pulled from a source. For example, the events that increment
+// the height of each blockchain. Implicit events are scheduled one
+// at a time, up to the last event loaded or pulled from a source,
+// so sources should be added before loading.
+// The events are added in bulk, without sorting them.
+func (q *EventQueue) LoadEventsIntoQueue() error {
+	// The loaded events are given their places in the queue where they are
+	batch := q.loader
+	q.loader = nil
+	for i, x := range batch {
+		batch[i] = q.entry(x.event, true)
+		q.extend(x.event.Time())
+	}
 
-		if !started {
-			// initialize implicit timer to start at the same time as the first event
-			implicit_timer = event.Time()
-			started = true
+	q.queue.load(batch)
+	for _, x := range batch {
+		for _, o := range q.observers {
+			o.OnEnqueue(q.BatonState.Sim(), x.event)
 		}
+	}
 
-		MainEventQueue.Enqueue(event)
-
-		// Get the next event
-		next := EventLoader.Top()
-		if next == nil {
-			// no more events
-			break
-		}
+	if !q.implicit_started && !q.implicit_timer.IsZero() {
+		q.implicit_started = true
+		q.scheduleImplicit()
+	}
+	return nil
+}
 
-		// Add implicit events
-		evnt, err := MainEventQueue.BatonState.GetNextImplicit(implicit_timer, next.Time())
-		for err == nil {
-			MainEventQueue.Enqueue(evnt)
-			implicit_timer = evnt.Time()
-			next = EventLoader.Top()
-			evnt, err = MainEventQueue.BatonState.GetNextImplicit(implicit_timer, next.Time())
+// Notes an event loaded or pulled from a source at t. Implicit events
+// start with the first of these events and end with the last.
+func (q *EventQueue) extend(t time.Time) {
+	if !q.implicit_started && (q.implicit_timer.IsZero() || t.Before(q.implicit_timer)) {
+		q.implicit_timer = t
+	}
+	if t.After(q.horizon) {
+		q.horizon = t
+		if q.implicit_started && !q.implicit_pending {
+			q.scheduleImplicit()
 		}
 	}
+}
 
-	return nil
+// Schedules the next implicit event, unless it is after the horizon
+func (q *EventQueue) scheduleImplicit() {
+	evnt, err := q.BatonState.GetNextImplicit(q.implicit_timer, q.horizon)
+	if err != nil {
+		return
+	}
+	x := q.entry(evnt, false)
+	x.implicit = true
+	q.queue.push(x)
+	q.implicit_timer = evnt.Time()
+	q.implicit_pending = true
+	for _, o := range q.observers {
+		o.OnEnqueue(q.BatonState.Sim(), evnt)
+	}
 }
@@ -0,0 +1,29 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+// EventLoader pops the events added to the main event queue in time order,
+// and the events at the same time in the order they were added
+func TestEventLoader(t *testing.T) {
+	q := NewQueue()
+	start := q.BatonState.Start
+	first, second, third := NewSendEvent(start, "a", "b"), NewSendEvent(start.Add(time.Second), "a", "b"), NewSendEvent(start, "b", "a")
+	AddEventToLoad(second)
+	AddEventToLoad(first)
+	EventLoader.Insert(third)
+
+	if EventLoader.Len() != 3 || EventLoader.Top() != first {
+		t.Fatalf("loader has %d events, %v first", EventLoader.Len(), EventLoader.Top())
+	}
+	for i, want := range []Event{first, third, second} {
+		if got := EventLoader.Pop(); got != want {
+			t.Fatalf("event %d is %v, want %v", i, got, want)
+		}
+	}
+	if EventLoader.Pop() != nil || q.LoadEventsIntoQueue() != nil || q.Len() != 0 {
+		t.Fatalf("popped events were loaded")
+	}
+}
@@ -0,0 +1,36 @@
+package simulator
+
+// Rand is a small seeded pseudo random number generator (splitmix64).
+// Its whole state is a single integer, so runs are reproducible from a seed.
+type Rand struct {
+	State uint64
+}
+
+func NewRand(seed int64) *Rand {
+	return &Rand{State: uint64(seed)}
+}
+
+func (r *Rand) Uint64() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Float64 returns a number in [0, 1)
+func (r *Rand) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Int63n returns a number in [0, n). Returns 0 if n <= 0.
+func (r *Rand) Int63n(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	return int64(r.Uint64() % uint64(n))
+}
+
+func (r *Rand) Intn(n int) int {
+	return int(r.Int63n(int64(n)))
+}
@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// BlockRecord holds what was included in a single block of a chain.
+type BlockRecord struct {
+	Chain  string
+	Height uint64
+	Time   time.Time
+	Offset time.Duration // time since the start of the simulation
+	Txs    int
+	Msgs   int
+	ByKind [NUM_MSGS]int // messages by message type
+}
+
+// Recorder keeps a record of every block produced by every chain.
+type Recorder struct {
+	Records []BlockRecord
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{Records: make([]BlockRecord, 0)}
+}
+
+// RecordBlock records the transactions included in the chain's latest block.
+// Must be called before the chain's transaction count is reset.
+func (r *Recorder) RecordBlock(chain *Chain, start time.Time, t time.Time) {
+	rec := BlockRecord{
+		Chain:  chain.GetID(),
+		Height: chain.GetHeight(),
+		Time:   t,
+		Offset: t.Sub(start),
+		Txs:    chain.TxCount(),
+		Msgs:   chain.MsgCount(),
+	}
+	for kind := range rec.ByKind {
+		rec.ByKind[kind] = chain.BlockMsgs(uint32(kind))
+	}
+	r.Records = append(r.Records, rec)
+}
+
+// The columns of a block record, in order
+func blockColumns() []string {
+	columns := []string{"chain", "height", "time", "offset_ms", "txs", "msgs"}
+	for kind := uint32(0); kind < NUM_MSGS; kind++ {
+		columns = append(columns, MsgName(kind))
+	}
+	return columns
+}
+
+func (rec *BlockRecord) row() []string {
+	row := []string{
+		rec.Chain,
+		strconv.FormatUint(rec.Height, 10),
+		rec.Time.Format(time.RFC3339Nano),
+		strconv.FormatInt(rec.Offset.Milliseconds(), 10),
+		strconv.Itoa(rec.Txs),
+		strconv.Itoa(rec.Msgs),
+	}
+	for _, n := range rec.ByKind {
+		row = append(row, strconv.Itoa(n))
+	}
+	return row
+}
+
+// WriteCSV writes one row per block.
+func (r *Recorder) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(blockColumns()); err != nil {
+		return err
+	}
+
+	for i := range r.Records {
+		if err := writer.Write(r.Records[i].row()); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteColumnFiles writes every column to its own csv file in the directory,
+// named after the column. Row i of every file belongs to the same block.
+func (r *Recorder) WriteColumnFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	columns := blockColumns()
+	writers := make([]*csv.Writer, len(columns))
+	for i, column := range columns {
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s.csv", column)))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		writers[i] = csv.NewWriter(file)
+		if err := writers[i].Write([]string{column}); err != nil {
+			return err
+		}
+	}
+
+	for i := range r.Records {
+		for c, value := range r.Records[i].row() {
+			if err := writers[c].Write([]string{value}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, writer := range writers {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Records the blocks of the test queue
+func recordBlocks() *Recorder {
+	q, ctx := newTestQueue(10)
+	q.BatonState.Recorder = NewRecorder()
+	finish(q, ctx)
+	return q.BatonState.Recorder
+}
+
+// Every block is recorded with what it included
+func TestRecordBlock(t *testing.T) {
+	r := recordBlocks()
+	heights := make(map[string]uint64)
+	msgs := 0
+	for _, rec := range r.Records {
+		if rec.Height != heights[rec.Chain]+1 {
+			t.Fatalf("block %d of %s follows block %d", rec.Height, rec.Chain, heights[rec.Chain])
+		}
+		heights[rec.Chain] = rec.Height
+
+		sum := 0
+		for _, n := range rec.ByKind {
+			sum += n
+		}
+		if sum != rec.Msgs || rec.Txs > rec.Msgs {
+			t.Fatalf("block %d of %s has %d txs and %d messages, %d by type", rec.Height, rec.Chain, rec.Txs, rec.Msgs, sum)
+		}
+		msgs += rec.Msgs
+	}
+	if len(heights) != 4 || msgs == 0 {
+		t.Fatalf("%d messages recorded on %d chains", msgs, len(heights))
+	}
+}
+
+// The csv file and the column files hold the same values
+func TestWriteBlocks(t *testing.T) {
+	r := recordBlocks()
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(rows) != len(r.Records)+1 {
+		t.Fatalf("%d rows for %d blocks", len(rows), len(r.Records))
+	}
+	if rows[0] != strings.Join(blockColumns(), ",") {
+		t.Fatalf("header is %s", rows[0])
+	}
+	if got, want := strings.Split(rows[1], ",")[3], strconv.FormatInt(r.Records[0].Offset.Milliseconds(), 10); got != want {
+		t.Fatalf("first block is at %s ms, want %s", got, want)
+	}
+
+	dir := t.TempDir()
+	if err := r.WriteColumnFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	for c, column := range blockColumns() {
+		data, err := os.ReadFile(filepath.Join(dir, column+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(values) != len(rows) {
+			t.Fatalf("%d values in column %s, want %d", len(values), column, len(rows))
+		}
+		for i, row := range rows {
+			if cell := strings.Split(row, ",")[c]; values[i] != cell {
+				t.Fatalf("row %d of column %s is %s, want %s", i, column, values[i], cell)
+			}
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EventType describes how events of one type are encoded and decoded.
+type EventType struct {
+	ID       uint64 // returned by the events' Type method
+	Name     string // identifies the type in encoded events
+	Priority int    // priority class of its events. See SetEventPriority
+
+	fields func(e Event) (any, error)
+	build  func(t time.Time, decode func(fields any) error) (Event, error)
+}
+
+var (
+	eventTypes      = make(map[uint64]*EventType)
+	eventTypeByName = make(map[string]*EventType)
+)
+
+// RegisterEventType registers a custom event type, so that its events can be
+// encoded in checkpoints, event lists and traces. fields returns the fields of an
+// event in a value that encoding/json and encoding/gob can encode, and build
+// creates an event at time t from those fields. The ID must be the value returned
+// by the events' Type method and at least FIRST_CUSTOM_EVENT_TYPE. IDs and names
+// are unique. Custom events are transactions when they happen at the same time
+// as other events, unless SetEventPriority says otherwise. Every custom event
+// type also gets a "<name>_events" metric that counts its events run.
+//
+// Event types are registered before any simulation runs, usually in an init function.
+func RegisterEventType[E Event, D any](id uint64, name string, fields func(e E) D, build func(t time.Time, fields D) E) error {
+	if id < FIRST_CUSTOM_EVENT_TYPE {
+		return fmt.Errorf("event type %d is reserved for built in events. Custom event types start at %d", id, FIRST_CUSTOM_EVENT_TYPE)
+	}
+	if err := registerEventType(id, name, fields, build); err != nil {
+		return err
+	}
+	return RegisterMetric(eventMetric(name))
+}
+
+func registerEventType[E Event, D any](id uint64, name string, fields func(e E) D, build func(t time.Time, fields D) E) error {
+	if _, ok := eventTypes[id]; ok {
+		return fmt.Errorf("event type %d is already registered", id)
+	}
+	if _, ok := eventTypeByName[name]; ok {
+		return fmt.Errorf("event type %s is already registered", name)
+	}
+
+	et := &EventType{ID: id, Name: name, Priority: PRIORITY_TX}
+	et.fields = func(e Event) (any, error) {
+		ev, ok := e.(E)
+		if !ok {
+			return nil, fmt.Errorf("event %T does not belong to event type %s", e, name)
+		}
+		return fields(ev), nil
+	}
+	et.build = func(t time.Time, decode func(fields any) error) (Event, error) {
+		var d D
+		if err := decode(&d); err != nil {
+			return nil, err
+		}
+		return build(t, d), nil
+	}
+
+	eventTypes[id] = et
+	eventTypeByName[name] = et
+	return nil
+}
+
+// LookupEventType returns the registered event type with the given ID.
+func LookupEventType(id uint64) (*EventType, bool) {
+	et, ok := eventTypes[id]
+	return et, ok
+}
+
+// LookupEventName returns the registered event type with the given name.
+func LookupEventName(name string) (*EventType, bool) {
+	et, ok := eventTypeByName[name]
+	return et, ok
+}
+
+// EventTypes returns every registered event type, sorted by ID.
+func EventTypes() []*EventType {
+	types := make([]*EventType, 0, len(eventTypes))
+	for _, et := range eventTypes {
+		types = append(types, et)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].ID < types[j].ID })
+	return types
+}
+
+func mustRegister(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// The encoded fields of the built in events
+type genSendData struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+type updateData struct {
+	Packet    uint64 `json:"packet"`
+	Chain     string `json:"chain"`
+	Neighbour string `json:"neighbour"`
+	Attempts  int    `json:"attempts,omitempty"`
+}
+
+type heightData struct {
+	Chain string `json:"chain"`
+}
+
+type sendData struct {
+	Src  string   `json:"src"`
+	Dst  string   `json:"dst"`
+	Hops []string `json:"hops,omitempty"`
+}
+
+type deliverData struct {
+	Packet   uint64 `json:"packet"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+type sendSingleData struct {
+	Src    string   `json:"src"`
+	Dst    string   `json:"dst"`
+	Hops   []string `json:"hops,omitempty"`
+	Packet uint64   `json:"packet,omitempty"`
+}
+
+// Times are kept relative to the event, so encoded events can be moved in time
+type faultData struct {
+	Kind     uint32        `json:"kind"`
+	Chain    string        `json:"chain"`
+	Peer     string        `json:"peer,omitempty"`
+	Factor   float64       `json:"factor,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Active   bool          `json:"active"`
+}
+
+type topologyData struct {
+	Kind  uint32 `json:"kind"`
+	Chain string `json:"chain"`
+	Peer  string `json:"peer,omitempty"`
+}
+
+type packetData struct {
+	Packet uint64 `json:"packet"`
+}
+
+func init() {
+	mustRegister(registerEventType(GEN_SEND_EVENT_TYPE, "gen_send",
+		func(e *GenSendEvent) genSendData { return genSendData{e.Src, e.Dst} },
+		func(t time.Time, d genSendData) *GenSendEvent { return NewGenSendEvent(t, d.Src, d.Dst) }))
+
+	mustRegister(registerEventType(UPDATE_EVENT_TYPE, "update",
+		func(e *UpdateEvent) updateData { return updateData{e.packet, e.chain, e.neighbour, e.attempts} },
+		func(t time.Time, d updateData) *UpdateEvent {
+			e := NewUpdateEvent(t, d.Packet, d.Chain, d.Neighbour)
+			e.attempts = d.Attempts
+			return e
+		}))
+
+	mustRegister(registerEventType(HEIGHT_EVENT_TYPE, "height",
+		func(e *HeightEvent) heightData { return heightData{e.chain} },
+		func(t time.Time, d heightData) *HeightEvent { return NewHeightEvent(t, d.Chain) }))
+
+	mustRegister(registerEventType(SEND_EVENT_TYPE, "send",
+		func(e *SendEvent) sendData { return sendData{e.src_chain, e.dst_chain, e.hops} },
+		func(t time.Time, d sendData) *SendEvent {
+			e := NewSendEvent(t, d.Src, d.Dst)
+			e.hops = d.Hops
+			return e
+		}))
+
+	mustRegister(registerEventType(DELIVER_EVENT_TYPE, "deliver",
+		func(e *DeliverEvent) deliverData { return deliverData{e.packet, e.src, e.dst, e.attempts} },
+		func(t time.Time, d deliverData) *DeliverEvent {
+			e := NewDeliverEvent(t, d.Packet, d.Src, d.Dst)
+			e.attempts = d.Attempts
+			return e
+		}))
+
+	mustRegister(registerEventType(SEND_SINGLE_EVENT_TYPE, "send_single",
+		func(e *SendSingleEvent) sendSingleData {
+			return sendSingleData{e.src_chain, e.dst_chain, e.hops, e.packet}
+		},
+		func(t time.Time, d sendSingleData) *SendSingleEvent {
+			e := NewSendSingleEvent(t, d.Src, d.Dst)
+			e.hops = d.Hops
+			e.packet = d.Packet
+			return e
+		}))
+
+	mustRegister(registerEventType(FAULT_EVENT_TYPE, "fault",
+		func(e *FaultEvent) faultData {
+			f := e.fault
+			return faultData{f.Kind, f.Chain, f.Peer, f.Factor, f.End.Sub(f.Start), e.active}
+		},
+		func(t time.Time, d faultData) *FaultEvent {
+			f := &Fault{Kind: d.Kind, Chain: d.Chain, Peer: d.Peer, Factor: d.Factor, Start: t}
+			if !d.Active {
+				f.Start = t.Add(-d.Duration)
+			}
+			f.End = f.Start.Add(d.Duration)
+			return NewFaultEvent(t, f, d.Active)
+		}))
+
+	mustRegister(registerEventType(TOPOLOGY_EVENT_TYPE, "topology",
+		func(e *TopologyEvent) topologyData {
+			return topologyData{e.change.Kind, e.change.Chain, e.change.Peer}
+		},
+		func(t time.Time, d topologyData) *TopologyEvent {
+			return NewTopologyEvent(&TopologyChange{Kind: d.Kind, Chain: d.Chain, Peer: d.Peer, Time: t})
+		}))
+
+	mustRegister(registerEventType(TIMEOUT_EVENT_TYPE, "timeout",
+		func(e *TimeoutEvent) packetData { return packetData{e.packet} },
+		func(t time.Time, d packetData) *TimeoutEvent { return NewTimeoutEvent(t, d.Packet) }))
+
+	mustRegister(registerEventType(ACK_EVENT_TYPE, "ack",
+		func(e *AckEvent) packetData { return packetData{e.packet} },
+		func(t time.Time, d packetData) *AckEvent { return NewAckEvent(t, d.Packet) }))
+
+	eventTypes[FAULT_EVENT_TYPE].Priority = PRIORITY_NETWORK
+	eventTypes[TOPOLOGY_EVENT_TYPE].Priority = PRIORITY_NETWORK
+	eventTypes[HEIGHT_EVENT_TYPE].Priority = PRIORITY_BLOCK
+	eventTypes[TIMEOUT_EVENT_TYPE].Priority = PRIORITY_TIMEOUT
+}
+
+// EventRecord is the stable encoding of an event. Events that follow it are
+// encoded along with it.
+type EventRecord struct {
+	Kind      string          `json:"kind"`
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Following []EventRecord   `json:"following,omitempty"`
+}
+
+// EncodeEvent returns the stable encoding of an event and of the events following it.
+func EncodeEvent(e Event) (EventRecord, error) {
+	et, ok := LookupEventType(e.Type())
+	if !ok {
+		return EventRecord{}, fmt.Errorf("event type %d is not registered", e.Type())
+	}
+
+	fields, err := et.fields(e)
+	if err != nil {
+		return EventRecord{}, err
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return EventRecord{}, err
+	}
+
+	rec := EventRecord{Kind: et.Name, Time: e.Time(), Data: raw}
+	for _, follow := range e.Following() {
+		f, err := EncodeEvent(follow)
+		if err != nil {
+			return EventRecord{}, err
+		}
+		rec.Following = append(rec.Following, f)
+	}
+	return rec, nil
+}
+
+// DecodeEvent rebuilds an event, and the events following it, from its encoding.
+func DecodeEvent(rec EventRecord) (Event, error) {
+	et, ok := LookupEventName(rec.Kind)
+	if !ok {
+		return nil, fmt.Errorf("unknown event kind %s", rec.Kind)
+	}
+
+	e, err := et.build(rec.Time, func(fields any) error {
+		if len(rec.Data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(rec.Data, fields)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s event. %s", rec.Kind, err.Error())
+	}
+
+	if len(rec.Following) > 0 {
+		following := make([]Event, len(rec.Following))
+		for i, f := range rec.Following {
+			if following[i], err = DecodeEvent(f); err != nil {
+				return nil, err
+			}
+		}
+		e.SetFollowing(following)
+	}
+	return e, nil
+}
+
+// MarshalEventJSON encodes an event, and the events following it, as JSON.
+func MarshalEventJSON(e Event) ([]byte, error) {
+	rec, err := EncodeEvent(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rec)
+}
+
+// UnmarshalEventJSON decodes an event encoded by MarshalEventJSON.
+func UnmarshalEventJSON(data []byte) (Event, error) {
+	var rec EventRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return DecodeEvent(rec)
+}
+
+// MarshalEventBinary encodes an event, and the events following it, in a compact
+// binary form: the type ID, the time, the gob encoded fields and the following events.
+func MarshalEventBinary(e Event) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeEventBinary(buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	buf.Write(b)
+}
+
+func writeEventBinary(buf *bytes.Buffer, e Event) error {
+	et, ok := LookupEventType(e.Type())
+	if !ok {
+		return fmt.Errorf("event type %d is not registered", e.Type())
+	}
+
+	fields, err := et.fields(e)
+	if err != nil {
+		return err
+	}
+	data := &bytes.Buffer{}
+	if err := gob.NewEncoder(data).Encode(fields); err != nil {
+		return err
+	}
+	t, err := e.Time().MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	buf.Write(binary.AppendUvarint(nil, et.ID))
+	writeBytes(buf, t)
+	writeBytes(buf, data.Bytes())
+
+	following := e.Following()
+	buf.Write(binary.AppendUvarint(nil, uint64(len(following))))
+	for _, follow := range following {
+		if err := writeEventBinary(buf, follow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalEventBinary decodes an event encoded by MarshalEventBinary.
+func UnmarshalEventBinary(data []byte) (Event, error) {
+	r := bytes.NewReader(data)
+	e, err := readEventBinary(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, errors.New("unexpected data after event")
+	}
+	return e, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, errors.New("event data is truncated")
+	}
+	b := make([]byte, n)
+	_, err = r.Read(b)
+	return b, err
+}
+
+func readEventBinary(r *bytes.Reader) (Event, error) {
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	et, ok := LookupEventType(id)
+	if !ok {
+		return nil, fmt.Errorf("event type %d is not registered", id)
+	}
+
+	tb, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	var t time.Time
+	if err := t.UnmarshalBinary(tb); err != nil {
+		return nil, err
+	}
+
+	data, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	e, err := et.build(t, func(fields any) error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(fields)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s event. %s", et.Name, err.Error())
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	// Every event takes at least a byte
+	if n > uint64(r.Len()) {
+		return nil, errors.New("event data is truncated")
+	}
+	if n > 0 {
+		following := make([]Event, n)
+		for i := range following {
+			if following[i], err = readEventBinary(r); err != nil {
+				return nil, err
+			}
+		}
+		e.SetFollowing(following)
+	}
+	return e, nil
+}
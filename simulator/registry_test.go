@@ -0,0 +1,33 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalEventBinaryCorrupt(t *testing.T) {
+	data, err := MarshalEventBinary(NewHeightEvent(time.Unix(0, 0), "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last byte is the number of following events
+	corrupt := binary.AppendUvarint(data[:len(data)-1:len(data)-1], 1<<62)
+	if _, err := UnmarshalEventBinary(corrupt); err == nil {
+		t.Fatalf("decoded an event with %d following events from %d bytes", uint64(1<<62), len(corrupt))
+	}
+	for i := range data {
+		if _, err := UnmarshalEventBinary(data[:i]); err == nil {
+			t.Fatalf("decoded an event truncated to %d bytes", i)
+		}
+	}
+
+	e, err := UnmarshalEventBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type() != HEIGHT_EVENT_TYPE || !e.Time().Equal(time.Unix(0, 0)) {
+		t.Fatalf("decoded %v", e)
+	}
+}
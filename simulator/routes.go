@@ -0,0 +1,161 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteUse is a route used to send packets from Src to Dst.
+type RouteUse struct {
+	Src      string
+	Dst      string
+	Hops     []string // chains on the route, including the source chain
+	Shortest int      // hops of the shortest path ignoring hubs when the route was first used
+	Packets  int
+}
+
+// HopCount returns the number of connections crossed by the route.
+func (r *RouteUse) HopCount() int {
+	return len(r.Hops) - 1
+}
+
+// Stretch returns how many times longer the route is than the shortest path ignoring hubs.
+func (r *RouteUse) Stretch() float64 {
+	if r.Shortest <= 0 {
+		return 1
+	}
+	return float64(r.HopCount()) / float64(r.Shortest)
+}
+
+// Crosses returns true if the chain is an intermediate chain of the route.
+func (r *RouteUse) Crosses(chain_id string) bool {
+	if len(r.Hops) < 3 {
+		return false
+	}
+	for _, hop := range r.Hops[1 : len(r.Hops)-1] {
+		if hop == chain_id {
+			return true
+		}
+	}
+	return false
+}
+
+// Pair is a source and destination chain.
+type Pair struct {
+	Src string
+	Dst string
+}
+
+// HopDistance returns the fewest connections between two chains, ignoring
+// hubs, or -1 if they are not connected. Unlike GetShortestPath, this draws
+// no random numbers, so it does not change the run.
+func (s *State) HopDistance(src, dst string) int {
+	if _, ok := s.Chains[src]; !ok {
+		return -1
+	}
+
+	dist := map[string]int{src: 0}
+	frontier := []string{src}
+	for len(frontier) > 0 {
+		next := make([]string, 0)
+		for _, id := range frontier {
+			if id == dst {
+				return dist[id]
+			}
+			for n := range s.Chains[id].GetNeighbours() {
+				if _, ok := dist[n]; !ok {
+					dist[n] = dist[id] + 1
+					next = append(next, n)
+				}
+			}
+		}
+		frontier = next
+	}
+	return -1
+}
+
+// recordRouteUse counts a packet sent over the route.
+func (s *State) recordRouteUse(src, dst string, hops []string) {
+	key := strings.Join(hops, ">")
+	r, ok := s.route_uses[key]
+	if !ok {
+		r = &RouteUse{Src: src, Dst: dst, Hops: hops, Shortest: s.HopDistance(src, dst)}
+		s.route_uses[key] = r
+	}
+	r.Packets++
+}
+
+// Routes returns every route used to send packets, sorted by source,
+// destination and route.
+func (s *State) Routes() []*RouteUse {
+	routes := make([]*RouteUse, 0, len(s.route_uses))
+	keys := make([]string, 0, len(s.route_uses))
+	for key := range s.route_uses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		routes = append(routes, s.route_uses[key])
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Src != routes[j].Src {
+			return routes[i].Src < routes[j].Src
+		}
+		return routes[i].Dst < routes[j].Dst
+	})
+	return routes
+}
+
+// UnreachablePairs returns the pairs of chains for which no route could be found
+// at some point during the run, sorted by source and destination.
+func (s *State) UnreachablePairs() []Pair {
+	pairs := make([]Pair, 0, len(s.unreachable))
+	for p := range s.unreachable {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Src != pairs[j].Src {
+			return pairs[i].Src < pairs[j].Src
+		}
+		return pairs[i].Dst < pairs[j].Dst
+	})
+	return pairs
+}
+
+// WriteRoutesCSV writes a row for every route used, followed by a row for every
+// unreachable pair with an empty route.
+func (s *State) WriteRoutesCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"src", "dst", "route", "hops", "shortest_hops", "stretch", "packets", "reachable"}); err != nil {
+		return err
+	}
+
+	for _, r := range s.Routes() {
+		row := []string{
+			r.Src,
+			r.Dst,
+			strings.Join(r.Hops, " "),
+			strconv.Itoa(r.HopCount()),
+			strconv.Itoa(r.Shortest),
+			strconv.FormatFloat(r.Stretch(), 'f', 4, 64),
+			strconv.Itoa(r.Packets),
+			"true",
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range s.UnreachablePairs() {
+		if err := writer.Write([]string{p.Src, p.Dst, "", "", "", "", "0", "false"}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
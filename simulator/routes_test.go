@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCrosses(t *testing.T) {
+	tests := []struct {
+		hops  []string
+		chain string
+		want  bool
+	}{
+		{[]string{"a", "b", "c"}, "b", true},
+		{[]string{"a", "b", "c"}, "a", false},
+		{[]string{"a", "b", "c"}, "c", false},
+		{[]string{"a", "b"}, "b", false},
+		{[]string{"a"}, "a", false},
+		{nil, "a", false},
+	}
+	for _, test := range tests {
+		r := &RouteUse{Hops: test.hops}
+		if got := r.Crosses(test.chain); got != test.want {
+			t.Fatalf("route %v crosses %s: %v, want %v", test.hops, test.chain, got, test.want)
+		}
+	}
+}
+
+// Hop distances over the line a-b-c-d, with e on its own
+func TestHopDistance(t *testing.T) {
+	q, _ := newTestQueue(0)
+	state := q.BatonState
+	state.AddChain(NewChain("e"))
+	tests := []struct {
+		src, dst string
+		want     int
+	}{
+		{"a", "a", 0}, {"a", "b", 1}, {"a", "d", 3}, {"d", "b", 2},
+		{"a", "e", -1}, {"x", "a", -1},
+	}
+	for _, test := range tests {
+		if got := state.HopDistance(test.src, test.dst); got != test.want {
+			t.Fatalf("%s is %d hops from %s, want %d", test.dst, got, test.src, test.want)
+		}
+	}
+
+	// A shortcut shortens the distance
+	state.OpenConnection("a", "c")
+	if got := state.HopDistance("a", "d"); got != 2 {
+		t.Fatalf("d is %d hops from a with the shortcut, want 2", got)
+	}
+}
+
+// Every route used is counted once per packet, with its stretch
+func TestRoutes(t *testing.T) {
+	q, ctx := newTestQueue(10)
+	finish(q, ctx)
+	state := q.BatonState
+
+	routes := state.Routes()
+	if len(routes) != 2 || routes[0].Src != "a" || routes[1].Src != "d" {
+		t.Fatalf("routes are %v", routes)
+	}
+	for _, r := range routes {
+		if r.Packets != 10 || r.Stretch() != 1 {
+			t.Fatalf("route %v carried %d packets with stretch %v", r.Hops, r.Packets, r.Stretch())
+		}
+	}
+	if !routes[0].Crosses("b") || !routes[0].Crosses("c") || routes[1].Crosses("b") {
+		t.Fatalf("routes cross the wrong chains")
+	}
+
+	var buf bytes.Buffer
+	if err := state.WriteRoutesCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(rows) != 3 || rows[1] != "a,d,a b c d,3,3,1.0000,10,true" {
+		t.Fatalf("routes csv is %q", rows)
+	}
+}
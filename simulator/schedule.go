@@ -0,0 +1,358 @@
+package simulator
+
+import "sort"
+
+// An event waiting in the queue. Events are ordered by their time in
+// nanoseconds, their priority class and then the order they were scheduled
+// in, so comparing two events never touches time.Time.
+type queued struct {
+	at       int64
+	seq      uint64
+	event    Event
+	priority uint8
+	loaded   bool  // loaded or pulled from a source rather than created by the run
+	implicit bool  // the next implicit event
+	source   int32 // 1 + the source it was pulled from, 0 if none
+}
+
+// Loaded events run before the events of the same class that the run creates
+// at the same time. Events loaded before the run starts are numbered before
+// any event the run creates, but events pulled from a source are numbered
+// when they are pulled, after the events created until then. Without this
+// rule, a streamed send and a client update at the same instant would run in
+// a different order than when the sends are all loaded up front.
+func (a queued) before(b queued) bool {
+	if a.at != b.at {
+		return a.at < b.at
+	}
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if a.loaded != b.loaded {
+		return a.loaded
+	}
+	return a.seq < b.seq
+}
+
+// Sorts events in the order they run
+func sortQueued(events []queued) {
+	sort.Slice(events, func(i, j int) bool { return events[i].before(events[j]) })
+}
+
+// schedule holds the events waiting in a queue.
+type schedule interface {
+	push(x queued)
+	load(xs []queued) // adds many events at once
+	top() (queued, bool)
+	pop() (queued, bool)
+	len() int
+	all() []queued // in no particular order
+}
+
+// Binary min heap of events
+type timeHeap struct {
+	heap []queued
+}
+
+func (h *timeHeap) up(i int) {
+	x := h.heap[i]
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !x.before(h.heap[parent]) {
+			break
+		}
+		h.heap[i] = h.heap[parent]
+		i = parent
+	}
+	h.heap[i] = x
+}
+
+func (h *timeHeap) down(i int) {
+	n := len(h.heap)
+	x := h.heap[i]
+	for {
+		child := 2*i + 1
+		if child >= n {
+			break
+		}
+		if right := child + 1; right < n && h.heap[right].before(h.heap[child]) {
+			child = right
+		}
+		if !h.heap[child].before(x) {
+			break
+		}
+		h.heap[i] = h.heap[child]
+		i = child
+	}
+	h.heap[i] = x
+}
+
+func (h *timeHeap) push(x queued) {
+	h.heap = append(h.heap, x)
+	h.up(len(h.heap) - 1)
+}
+
+// Appends the events and heapifies, which is linear in the size of the heap.
+// An empty heap takes over the events without copying them. A few events
+// added to a large heap are pushed one by one instead.
+func (h *timeHeap) load(xs []queued) {
+	if len(xs) < len(h.heap)/16 {
+		for _, x := range xs {
+			h.push(x)
+		}
+		return
+	}
+
+	if len(h.heap) == 0 {
+		h.heap = xs
+	} else {
+		h.heap = append(h.heap, xs...)
+	}
+	for i := len(h.heap)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h *timeHeap) top() (queued, bool) {
+	if len(h.heap) == 0 {
+		return queued{}, false
+	}
+	return h.heap[0], true
+}
+
+func (h *timeHeap) pop() (queued, bool) {
+	n := len(h.heap)
+	if n == 0 {
+		return queued{}, false
+	}
+	top := h.heap[0]
+	h.heap[0] = h.heap[n-1]
+	h.heap[n-1] = queued{}
+	h.heap = h.heap[:n-1]
+	if n > 1 {
+		h.down(0)
+	}
+	return top, true
+}
+
+func (h *timeHeap) len() int {
+	return len(h.heap)
+}
+
+func (h *timeHeap) all() []queued {
+	return h.heap
+}
+
+const (
+	MIN_CALENDAR_BUCKETS = 16
+	MIN_CALENDAR_WIDTH   = 1000 // nanoseconds
+)
+
+// Calendar queue (R. Brown, 1988). Events are hashed by time into buckets
+// that each cover one width of time per year, where a year is the width times
+// the number of buckets. Each bucket is kept sorted, so the next event is
+// found by walking the buckets from the current one. The number of buckets
+// follows the number of events and the width follows their spacing, which
+// keeps both pushing and popping constant time on average.
+type calendarQueue struct {
+	buckets [][]queued
+	width   int64
+	size    int
+
+	current int   // bucket of the last event popped
+	end     int64 // end of the current bucket in this year
+}
+
+func newCalendarQueue() *calendarQueue {
+	c := &calendarQueue{}
+	c.reset(MIN_CALENDAR_BUCKETS, MIN_CALENDAR_WIDTH, 0)
+	return c
+}
+
+// Number of widths since the zero time, rounded down
+func (c *calendarQueue) day(at int64) int64 {
+	d := at / c.width
+	if at < 0 && at%c.width != 0 {
+		d--
+	}
+	return d
+}
+
+func (c *calendarQueue) bucket(at int64) int {
+	n := int64(len(c.buckets))
+	i := c.day(at) % n
+	if i < 0 {
+		i += n
+	}
+	return int(i)
+}
+
+// Moves the current bucket to the one holding at
+func (c *calendarQueue) seek(at int64) {
+	c.current = c.bucket(at)
+	c.end = (c.day(at) + 1) * c.width
+}
+
+func (c *calendarQueue) reset(buckets int, width int64, at int64) {
+	c.buckets = make([][]queued, buckets)
+	c.width = width
+	c.seek(at)
+}
+
+func (c *calendarQueue) insert(x queued) {
+	i := c.bucket(x.at)
+	b := c.buckets[i]
+	// Events are mostly scheduled after the others in their bucket
+	if len(b) == 0 || !x.before(b[len(b)-1]) {
+		c.buckets[i] = append(b, x)
+		return
+	}
+	j := sort.Search(len(b), func(j int) bool { return x.before(b[j]) })
+	b = append(b, queued{})
+	copy(b[j+1:], b[j:])
+	b[j] = x
+	c.buckets[i] = b
+}
+
+func (c *calendarQueue) push(x queued) {
+	if x.at < c.end-c.width {
+		// Earlier than the current bucket
+		c.seek(x.at)
+	}
+	c.insert(x)
+	c.size++
+	if c.size > 2*len(c.buckets) {
+		c.resize(2 * len(c.buckets))
+	}
+}
+
+// Sizes the calendar for all the events at once, rather than growing it
+// while they are added
+func (c *calendarQueue) load(xs []queued) {
+	if c.size+len(xs) <= 2*len(c.buckets) {
+		for _, x := range xs {
+			c.push(x)
+		}
+		return
+	}
+
+	buckets := len(c.buckets)
+	for c.size+len(xs) > 2*buckets {
+		buckets *= 2
+	}
+	c.rebuild(buckets, xs)
+}
+
+// Finds the next event without removing it
+func (c *calendarQueue) next() (int, bool) {
+	if c.size == 0 {
+		return 0, false
+	}
+	for k := 0; k < len(c.buckets); k++ {
+		if b := c.buckets[c.current]; len(b) > 0 && b[0].at < c.end {
+			return c.current, true
+		}
+		c.current = (c.current + 1) % len(c.buckets)
+		c.end += c.width
+	}
+
+	// Nothing this year, so look at the first event of every bucket
+	min := -1
+	for i, b := range c.buckets {
+		if len(b) > 0 && (min < 0 || b[0].before(c.buckets[min][0])) {
+			min = i
+		}
+	}
+	c.seek(c.buckets[min][0].at)
+	return min, true
+}
+
+func (c *calendarQueue) top() (queued, bool) {
+	i, ok := c.next()
+	if !ok {
+		return queued{}, false
+	}
+	return c.buckets[i][0], true
+}
+
+func (c *calendarQueue) pop() (queued, bool) {
+	i, ok := c.next()
+	if !ok {
+		return queued{}, false
+	}
+	b := c.buckets[i]
+	x := b[0]
+	b[0] = queued{}
+	c.buckets[i] = b[1:]
+	c.size--
+	if len(c.buckets) > MIN_CALENDAR_BUCKETS && c.size < len(c.buckets)/2 {
+		c.resize(len(c.buckets) / 2)
+	}
+	return x, true
+}
+
+func (c *calendarQueue) resize(buckets int) {
+	c.rebuild(buckets, nil)
+}
+
+// Rehashes the events, and any new ones, into a number of buckets, with the
+// width set to a few times the average time between events. The old buckets
+// are released as they are emptied.
+func (c *calendarQueue) rebuild(buckets int, xs []queued) {
+	old := c.buckets
+	n := c.size + len(xs)
+	first, last := int64(0), int64(0)
+	seen := false
+	span := func(x queued) {
+		if !seen || x.at < first {
+			first = x.at
+		}
+		if !seen || x.at > last {
+			last = x.at
+		}
+		seen = true
+	}
+	for _, b := range old {
+		for _, x := range b {
+			span(x)
+		}
+	}
+	for _, x := range xs {
+		span(x)
+	}
+
+	width := int64(MIN_CALENDAR_WIDTH)
+	if n > 1 {
+		if w := 3 * ((last - first) / int64(n)); w > width {
+			width = w
+		}
+	}
+	at := c.end - c.width
+	if seen {
+		at = first
+	}
+
+	c.reset(buckets, width, at)
+	for i, b := range old {
+		for _, x := range b {
+			c.insert(x)
+		}
+		old[i] = nil
+	}
+	for _, x := range xs {
+		c.insert(x)
+	}
+	c.size = n
+}
+
+func (c *calendarQueue) len() int {
+	return c.size
+}
+
+func (c *calendarQueue) all() []queued {
+	events := make([]queued, 0, c.size)
+	for _, b := range c.buckets {
+		events = append(events, b...)
+	}
+	return events
+}
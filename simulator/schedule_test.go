@@ -0,0 +1,177 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+// Start of the schedules under test, in nanoseconds since 1970
+const testEpoch = int64(1700000000) * int64(time.Second)
+
+// Builds random events and checks that the heap and the calendar queue run
+// them in the same order, while events are loaded in bulk, pushed around the
+// current time and popped in between.
+func TestCalendarMatchesHeap(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := NewRand(seed)
+		heap, calendar := &timeHeap{}, newCalendarQueue()
+		seq := uint64(0)
+		now := testEpoch
+
+		// Events spread over a random span, so that some share a time
+		event := func(span int64) queued {
+			seq++
+			return queued{
+				at:       now + rng.Int63n(span),
+				seq:      seq,
+				priority: uint8(rng.Intn(PRIORITY_TIMEOUT + 1)),
+				loaded:   rng.Intn(4) == 0,
+			}
+		}
+
+		popped := 0
+		for round := 0; round < 50; round++ {
+			switch rng.Intn(4) {
+			case 0:
+				// Bulk load, with spans from microseconds to hours
+				span := int64(1000) << rng.Intn(40)
+				xs := make([]queued, rng.Intn(3000))
+				for i := range xs {
+					xs[i] = event(span)
+				}
+				heap.load(append([]queued(nil), xs...))
+				calendar.load(xs)
+			case 1:
+				// An event before the last one popped
+				seq++
+				x := queued{at: now - rng.Int63n(int64(time.Second)), seq: seq}
+				heap.push(x)
+				calendar.push(x)
+			default:
+				for i := rng.Intn(200); i >= 0; i-- {
+					x := event(int64(10 * time.Second))
+					heap.push(x)
+					calendar.push(x)
+				}
+			}
+
+			for i := rng.Intn(2000); i >= 0; i-- {
+				a, ok := heap.pop()
+				b, ok_b := calendar.pop()
+				if ok != ok_b || a.at != b.at || a.seq != b.seq {
+					t.Fatalf("seed %d: event %d is %v (%d, %d) in the heap but %v (%d, %d) in the calendar", seed, popped, ok, a.at, a.seq, ok_b, b.at, b.seq)
+				}
+				if !ok {
+					break
+				}
+				now = a.at
+				popped++
+			}
+			if heap.len() != calendar.len() {
+				t.Fatalf("seed %d: %d events in the heap but %d in the calendar", seed, heap.len(), calendar.len())
+			}
+		}
+
+		for {
+			a, ok := heap.pop()
+			b, ok_b := calendar.pop()
+			if ok != ok_b || a.at != b.at || a.seq != b.seq {
+				t.Fatalf("seed %d: event %d is (%d, %d) in the heap but (%d, %d) in the calendar", seed, popped, a.at, a.seq, b.at, b.seq)
+			}
+			if !ok {
+				break
+			}
+			popped++
+		}
+	}
+}
+
+// Events spread evenly over n milliseconds
+func benchEvents(n int) []queued {
+	rng := NewRand(1)
+	xs := make([]queued, n)
+	for i := range xs {
+		xs[i] = queued{at: testEpoch + rng.Int63n(int64(n)*int64(time.Millisecond)), seq: uint64(i)}
+	}
+	return xs
+}
+
+// Loads a million events at once and pops them all
+func benchmarkLoad(b *testing.B, create func() schedule) {
+	const n = 1000000
+	xs := benchEvents(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		batch := append([]queued(nil), xs...)
+		s := create()
+		b.StartTimer()
+
+		s.load(batch)
+		for _, ok := s.pop(); ok; _, ok = s.pop() {
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/n, "ns/event")
+}
+
+// Keeps size events in the schedule while every popped event schedules
+// another one up to a second later
+func benchmarkHold(b *testing.B, create func() schedule, size int) {
+	s := create()
+	s.load(benchEvents(size))
+	rng := NewRand(2)
+	seq := uint64(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, _ := s.pop()
+		seq++
+		s.push(queued{at: x.at + rng.Int63n(int64(time.Second)), seq: seq})
+	}
+}
+
+func newHeapSchedule() schedule     { return &timeHeap{} }
+func newCalendarSchedule() schedule { return newCalendarQueue() }
+
+func BenchmarkHeapLoad(b *testing.B)       { benchmarkLoad(b, newHeapSchedule) }
+func BenchmarkCalendarLoad(b *testing.B)   { benchmarkLoad(b, newCalendarSchedule) }
+func BenchmarkHeapHold1K(b *testing.B)     { benchmarkHold(b, newHeapSchedule, 1000) }
+func BenchmarkCalendarHold1K(b *testing.B) { benchmarkHold(b, newCalendarSchedule, 1000) }
+func BenchmarkHeapHold1M(b *testing.B)     { benchmarkHold(b, newHeapSchedule, 1000000) }
+func BenchmarkCalendarHold1M(b *testing.B) { benchmarkHold(b, newCalendarSchedule, 1000000) }
+
+// Both schedules run events at the same time by priority class, then loaded
+// events first, then in the order they were scheduled
+func TestSameTimeOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second queued
+	}{
+		{"earlier time", queued{at: testEpoch, seq: 2, priority: PRIORITY_TIMEOUT}, queued{at: testEpoch + 1, seq: 1, priority: PRIORITY_NETWORK}},
+		{"network before block", queued{at: testEpoch, seq: 2, priority: PRIORITY_NETWORK}, queued{at: testEpoch, seq: 1, priority: PRIORITY_BLOCK}},
+		{"block before tx", queued{at: testEpoch, seq: 2, priority: PRIORITY_BLOCK}, queued{at: testEpoch, seq: 1, priority: PRIORITY_TX}},
+		{"tx before timeout", queued{at: testEpoch, seq: 2, priority: PRIORITY_TX}, queued{at: testEpoch, seq: 1, priority: PRIORITY_TIMEOUT}},
+		{"class before loaded", queued{at: testEpoch, seq: 2, priority: PRIORITY_BLOCK}, queued{at: testEpoch, seq: 1, priority: PRIORITY_TX, loaded: true}},
+		{"loaded first", queued{at: testEpoch, seq: 2, priority: PRIORITY_TX, loaded: true}, queued{at: testEpoch, seq: 1, priority: PRIORITY_TX}},
+		{"by seq", queued{at: testEpoch, seq: 1, priority: PRIORITY_TX}, queued{at: testEpoch, seq: 2, priority: PRIORITY_TX}},
+		{"loaded by seq", queued{at: testEpoch, seq: 1, priority: PRIORITY_TX, loaded: true}, queued{at: testEpoch, seq: 2, priority: PRIORITY_TX, loaded: true}},
+	}
+
+	for _, create := range []func() schedule{newHeapSchedule, newCalendarSchedule} {
+		for _, test := range tests {
+			for _, loaded := range []bool{false, true} {
+				s := create()
+				if loaded {
+					s.load([]queued{test.second, test.first})
+				} else {
+					s.push(test.second)
+					s.push(test.first)
+				}
+				first, _ := s.pop()
+				second, _ := s.pop()
+				if first.seq != test.first.seq || second.seq != test.second.seq {
+					t.Fatalf("%T %s: ran %d then %d, want %d then %d", s, test.name, first.seq, second.seq, test.first.seq, test.second.seq)
+				}
+			}
+		}
+	}
+}
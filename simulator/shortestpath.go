@@ -2,9 +2,8 @@ package simulator
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
-	"math/big"
+	"sort"
 )
 
 // GetShortestPath returns the shortest path from the source chain to the destination
@@ -37,7 +36,11 @@ func GetShortestPath(ctx context.Context, src string, dst string, hubs map[strin
 	src_found, dst_found := false, false
 	const inf = 100000000
 	event_queue := &EventHeap{}
-	for chain := range state.Chains {
+	for _, chain := range state.ChainIDs() {
+		if _, ok := state.Chains[chain]; !ok {
+			continue
+		}
+
 		var de *DijkstraEvent
 		if chain == src {
 			src_found = true
@@ -92,8 +95,15 @@ func GetShortestPath(ctx context.Context, src string, dst string, hubs map[strin
 			continue
 		}
 
-		// Update all neighbours
+		// Update all neighbours. Visit them in order so that ties are
+		// broken the same way for the same seed.
+		neighbours := make([]string, 0, len(state.Chains[node.Chain].neighbours))
 		for n := range state.Chains[node.Chain].neighbours {
+			neighbours = append(neighbours, n)
+		}
+		sort.Strings(neighbours)
+
+		for _, n := range neighbours {
 			c_event, c_index := event_queue.Find(&DijkstraEvent{Chain: n}, cmp)
 
 			if c_event != nil {
@@ -110,7 +120,7 @@ func GetShortestPath(ctx context.Context, src string, dst string, hubs map[strin
 					// Replace with probability 1/amount
 					p := prev_chain[c_dijk_event.Chain]
 					p.Amount++
-					if do_replace, err := rand.Int(rand.Reader, big.NewInt(int64(p.Amount))); err == nil && do_replace.Int64() == 0 {
+					if state.Rand.Int63n(int64(p.Amount)) == 0 {
 						p.Chain_id = node.Chain
 					}
 					prev_chain[c_dijk_event.Chain] = p
@@ -122,6 +132,11 @@ func GetShortestPath(ctx context.Context, src string, dst string, hubs map[strin
 		node = event_queue.Pop().(*DijkstraEvent)
 	}
 
+	// The destination may be popped before any other unreachable chain
+	if node.Distance == inf {
+		return nil, errors.New("unreachable")
+	}
+
 	// create path
 	sp = append(sp, dst)
 	next_chain := prev_chain[dst]
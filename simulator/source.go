@@ -0,0 +1,58 @@
+package simulator
+
+import "fmt"
+
+// Source generates events as the run reaches them, instead of loading them
+// all before the run starts. Only the next event of a source waits in the
+// queue, so a source of millions of events takes no more memory than one.
+type Source interface {
+	// Next returns the next event, or nil if there are no more. Events are
+	// returned in the order of their times.
+	Next() Event
+}
+
+// AddSource adds a source of events. Its events count as loaded, and run
+// as if they had all been loaded before the run. Sources should be added
+// before LoadEventsIntoQueue, so that implicit events start from their
+// first events.
+func (q *EventQueue) AddSource(src Source) {
+	q.sources = append(q.sources, src)
+	q.pull(len(q.sources) - 1)
+}
+
+// ResumeSource gives a restored queue the source it was pulling events from
+// when the snapshot was taken. The source must continue after the events
+// already pulled. A source that is not given back has no more events.
+func (q *EventQueue) ResumeSource(i int, src Source) error {
+	if i < 0 || i >= len(q.sources) {
+		return fmt.Errorf("the queue has no source %d", i)
+	}
+	q.sources[i] = src
+	return nil
+}
+
+// Sources returns the number of sources the queue has pulled events from.
+func (q *EventQueue) Sources() int {
+	return len(q.sources)
+}
+
+// Queues the next event of a source
+func (q *EventQueue) pull(i int) {
+	src := q.sources[i]
+	if src == nil {
+		return
+	}
+	event := src.Next()
+	if event == nil {
+		q.sources[i] = nil
+		return
+	}
+
+	x := q.entry(event, true)
+	x.source = int32(i + 1)
+	q.queue.push(x)
+	q.extend(event.Time())
+	for _, o := range q.observers {
+		o.OnEnqueue(q.BatonState.Sim(), event)
+	}
+}
@@ -2,10 +2,10 @@ package simulator
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
+	"io"
+	"os"
 	"time"
 )
 
@@ -22,19 +22,79 @@ type ImplicitEventTracker struct {
 
 // Global simulator state
 type State struct {
-	Seq    uint64
+	Seq    uint64 // events scheduled so far, which orders events at the same time
 	Chains map[string]*Chain
 	Time   time.Time
+	Start  time.Time // reference point for scheduled scenarios
+	Log    io.Writer // where events log what they do. nil to discard
+
+	Faults   *FaultState
+	Topology TopologyStats
+	Packets  map[uint64]*Packet
+	Finished *PacketStats // packets dropped once finished. nil to keep every packet
+
+	Rand         *Rand
+	Failures     *FailureModel // nil when submissions never fail
+	FailureStats FailureStats
+
+	Acks         bool // relay acknowledgements back to the source chain
+	Gas          *GasSchedule
+	RelayerCosts map[string]*Cost
+	Batching     *BatchModel // nil when every message is its own transaction
+	Recorder     *Recorder   // nil when blocks are not recorded
+
+	queue        *EventQueue // queue that runs the events for this state
+	packet_seq   uint64
+	reserved     map[string]bool   // chains that join during the run
+	routes       map[string]*route // route cache
+	batches      map[string]*batch // open transactions by relayer and chain
+	stale_routes map[string]*route // routes used before the last topology change
+	edge_traffic map[string]*EdgeTraffic
+	route_uses   map[string]*RouteUse // routes used to send packets
+	unreachable  map[Pair]bool        // pairs without a route at some point
+	metrics      map[string]float64   // custom metrics
 
 	// Add periodic events for implicit event loading
 	implicit_tracker []ImplicitEventTracker // time until next event in milliseconds
 }
 
 func NewState() *State {
-	s := &State{Seq: 0, Chains: make(map[string]*Chain)}
+	s := &State{
+		Seq:     0,
+		Chains:  make(map[string]*Chain),
+		Start:   time.Now(),
+		Log:     os.Stdout,
+		Faults:  NewFaultState(),
+		Packets: make(map[uint64]*Packet),
+		Rand:    NewRand(time.Now().UnixNano()),
+
+		Gas:          NewGasSchedule(),
+		RelayerCosts: make(map[string]*Cost),
+
+		reserved:     make(map[string]bool),
+		routes:       make(map[string]*route),
+		batches:      make(map[string]*batch),
+		stale_routes: make(map[string]*route),
+		edge_traffic: make(map[string]*EdgeTraffic),
+		route_uses:   make(map[string]*RouteUse),
+		unreachable:  make(map[Pair]bool),
+		metrics:      make(map[string]float64),
+	}
 	return s
 }
 
+// Enqueue schedules an event on the queue running this state
+func (s *State) Enqueue(event Event) {
+	s.queue.Enqueue(event)
+}
+
+// Logf writes to the state's log, if there is one
+func (s *State) Logf(format string, a ...any) {
+	if s.Log != nil {
+		fmt.Fprintf(s.Log, format, a...)
+	}
+}
+
 func (s *State) AddChain(ch *Chain) {
 	s.Chains[ch.GetID()] = ch
 	// fmt.Printf("Add chain %s : %v\n", ch.id, ch.view)
@@ -44,15 +104,15 @@ func (s *State) AddChain(ch *Chain) {
 // blockchains have been added.
 func (s *State) InitializeImplicitEvents() {
 	// Add info for implicit events: Height Update x Number of chains.
-	num_chains := len(s.Chains)
-	s.implicit_tracker = make([]ImplicitEventTracker, num_chains)
+	// Chains reserved to join later also need height updates.
+	chain_ids := s.ChainIDs()
+	s.implicit_tracker = make([]ImplicitEventTracker, len(chain_ids))
 
 	i := 0
-	for chain_name := range s.Chains {
-		ri, _ := rand.Int(rand.Reader, big.NewInt(IMPLICIT_HEIGHT_INTERVAL))
+	for _, chain_name := range chain_ids {
 		s.implicit_tracker[i] = ImplicitEventTracker{
 			Type:     IMPLICIT_HEIGHT,
-			Interval: uint32(ri.Int64()),
+			Interval: uint32(s.Rand.Int63n(IMPLICIT_HEIGHT_INTERVAL)),
 			Evnt:     NewHeightEvent(time.Now(), chain_name),
 		}
 		i++
@@ -76,6 +136,10 @@ func GetStateFromContext(ctx context.Context) (*State, error) {
 // Returns the time and type of next implicit event. Will return an error if there are no
 // events that should be added to the loader.
 func (s *State) GetNextImplicit(curr time.Time, max time.Time) (Event, error) {
+	if len(s.implicit_tracker) == 0 {
+		return nil, errors.New("no implicit events")
+	}
+
 	// find the minimum time
 	min_time := -1
 	min_event := -1
@@ -0,0 +1,171 @@
+package simulator
+
+import (
+	"math"
+	"sort"
+)
+
+// LoadSummary describes the distribution of transactions per block of a chain.
+type LoadSummary struct {
+	Blocks     int
+	Mean       float64
+	P50        int
+	P90        int
+	P99        int
+	Max        int
+	AboveShare float64 // share of blocks with more transactions than the threshold
+}
+
+// SummarizeLoad summarizes a histogram of transactions per block.
+func SummarizeLoad(hist map[int]int, threshold int) LoadSummary {
+	loads := make([]int, 0, len(hist))
+	summary := LoadSummary{}
+	total := 0
+	above := 0
+	for load, n := range hist {
+		loads = append(loads, load)
+		summary.Blocks += n
+		total += load * n
+		if load > threshold {
+			above += n
+		}
+	}
+
+	if summary.Blocks == 0 {
+		return summary
+	}
+	sort.Ints(loads)
+
+	// Walk the histogram until the rank of each percentile is reached
+	percentile := func(p float64) int {
+		rank := int(math.Ceil(p * float64(summary.Blocks)))
+		seen := 0
+		for _, load := range loads {
+			seen += hist[load]
+			if seen >= rank {
+				return load
+			}
+		}
+		return loads[len(loads)-1]
+	}
+
+	summary.Mean = float64(total) / float64(summary.Blocks)
+	summary.P50 = percentile(0.5)
+	summary.P90 = percentile(0.9)
+	summary.P99 = percentile(0.99)
+	summary.Max = loads[len(loads)-1]
+	summary.AboveShare = float64(above) / float64(summary.Blocks)
+	return summary
+}
+
+// Gini returns the Gini coefficient of the values. 0 means the load is spread evenly,
+// values close to 1 mean it is concentrated on a few chains.
+func Gini(values []float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	weighted := 0.0
+	for i, v := range sorted {
+		sum += v
+		weighted += float64(i+1) * v
+	}
+	if sum == 0 {
+		return 0
+	}
+	return 2*weighted/(float64(n)*sum) - float64(n+1)/float64(n)
+}
+
+// Concentration returns the share of the total held by the largest value, and the
+// Herfindahl-Hirschman index (sum of squared shares) of the values.
+func Concentration(values []float64) (float64, float64) {
+	sum := 0.0
+	max := 0.0
+	for _, v := range values {
+		sum += v
+		if v > max {
+			max = v
+		}
+	}
+	if sum == 0 {
+		return 0, 0
+	}
+
+	hhi := 0.0
+	for _, v := range values {
+		hhi += (v / sum) * (v / sum)
+	}
+	return max / sum, hhi
+}
+
+// MetricStats summarizes a metric over replicated runs.
+type MetricStats struct {
+	Name   string
+	N      int
+	Mean   float64
+	SD     float64 // sample standard deviation
+	CILow  float64 // bounds of the 95% confidence interval of the mean
+	CIHigh float64
+}
+
+// Two-sided 95% critical values of Student's t distribution for 1 to 30 degrees of freedom
+var tCritical = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// TCritical95 returns the two-sided 95% critical value of Student's t distribution.
+// Between tabulated degrees of freedom, the more conservative value is used.
+func TCritical95(df int) float64 {
+	switch {
+	case df < 1:
+		return math.Inf(1)
+	case df <= len(tCritical):
+		return tCritical[df-1]
+	case df < 40:
+		return 2.042
+	case df < 60:
+		return 2.021
+	case df < 120:
+		return 2.000
+	}
+	return 1.980
+}
+
+// SummarizeReplicates returns the mean, standard deviation and 95% confidence
+// interval of every metric over the runs. Every run must give its metrics in
+// the same order, as Summarize does.
+func SummarizeReplicates(runs [][]Metric) []MetricStats {
+	if len(runs) == 0 {
+		return nil
+	}
+
+	stats := make([]MetricStats, len(runs[0]))
+	for i, m := range runs[0] {
+		st := MetricStats{Name: m.Name, N: len(runs)}
+		for _, run := range runs {
+			st.Mean += run[i].Value
+		}
+		st.Mean /= float64(st.N)
+
+		st.CILow, st.CIHigh = st.Mean, st.Mean
+		if st.N > 1 {
+			for _, run := range runs {
+				st.SD += (run[i].Value - st.Mean) * (run[i].Value - st.Mean)
+			}
+			st.SD = math.Sqrt(st.SD / float64(st.N-1))
+
+			margin := TCritical95(st.N-1) * st.SD / math.Sqrt(float64(st.N))
+			st.CILow = st.Mean - margin
+			st.CIHigh = st.Mean + margin
+		}
+		stats[i] = st
+	}
+	return stats
+}
@@ -0,0 +1,114 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSummarizeLoad(t *testing.T) {
+	got := SummarizeLoad(map[int]int{0: 5, 1: 3, 10: 2}, 5)
+	want := LoadSummary{Blocks: 10, Mean: 2.3, P50: 0, P90: 10, P99: 10, Max: 10, AboveShare: 0.2}
+	if !near(got.Mean, want.Mean) || !near(got.AboveShare, want.AboveShare) {
+		t.Fatalf("load summary is %+v, want %+v", got, want)
+	}
+	got.Mean, got.AboveShare = want.Mean, want.AboveShare
+	if got != want {
+		t.Fatalf("load summary is %+v, want %+v", got, want)
+	}
+	if got := SummarizeLoad(map[int]int{}, 5); got != (LoadSummary{}) {
+		t.Fatalf("summary of no blocks is %+v", got)
+	}
+}
+
+func TestGini(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{0, 0}, 0},
+		{[]float64{5, 5, 5, 5}, 0},
+		{[]float64{0, 0, 0, 1}, 0.75},
+		{[]float64{4, 1, 3, 2}, 0.25},
+		{[]float64{1, 3}, 0.25},
+	}
+	for _, test := range tests {
+		if got := Gini(test.values); !near(got, test.want) {
+			t.Fatalf("Gini of %v is %v, want %v", test.values, got, test.want)
+		}
+	}
+}
+
+func TestConcentration(t *testing.T) {
+	tests := []struct {
+		values   []float64
+		top, hhi float64
+	}{
+		{nil, 0, 0},
+		{[]float64{1, 1, 2}, 0.5, 0.375},
+		{[]float64{1, 1, 1, 1}, 0.25, 0.25},
+		{[]float64{0, 7}, 1, 1},
+	}
+	for _, test := range tests {
+		top, hhi := Concentration(test.values)
+		if !near(top, test.top) || !near(hhi, test.hhi) {
+			t.Fatalf("concentration of %v is %v and %v, want %v and %v", test.values, top, hhi, test.top, test.hhi)
+		}
+	}
+}
+
+func TestTCritical95(t *testing.T) {
+	tests := []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706}, {2, 4.303}, {10, 2.228}, {30, 2.042}, {35, 2.042}, {40, 2.021}, {59, 2.021}, {60, 2.000}, {120, 1.980}, {100000, 1.980},
+	}
+	for _, test := range tests {
+		if got := TCritical95(test.df); got != test.want {
+			t.Fatalf("t critical value for %d degrees of freedom is %v, want %v", test.df, got, test.want)
+		}
+	}
+	if !math.IsInf(TCritical95(0), 1) {
+		t.Fatalf("t critical value for no degrees of freedom is %v", TCritical95(0))
+	}
+
+	// More degrees of freedom never widen the interval
+	for df := 2; df < 200; df++ {
+		if TCritical95(df) > TCritical95(df-1) {
+			t.Fatalf("t critical value for %d degrees of freedom is above the one for %d", df, df-1)
+		}
+	}
+}
+
+func TestSummarizeReplicates(t *testing.T) {
+	runs := [][]Metric{
+		{{"x", 1}, {"y", 5}},
+		{{"x", 2}, {"y", 5}},
+		{{"x", 3}, {"y", 5}},
+	}
+	stats := SummarizeReplicates(runs)
+	if len(stats) != 2 || stats[0].Name != "x" || stats[1].Name != "y" {
+		t.Fatalf("replicates summarized as %+v", stats)
+	}
+
+	margin := 4.303 / math.Sqrt(3)
+	x := stats[0]
+	if x.N != 3 || !near(x.Mean, 2) || !near(x.SD, 1) || !near(x.CILow, 2-margin) || !near(x.CIHigh, 2+margin) {
+		t.Fatalf("x summarized as %+v", x)
+	}
+	if y := stats[1]; y.SD != 0 || y.CILow != 5 || y.CIHigh != 5 {
+		t.Fatalf("constant y summarized as %+v", y)
+	}
+
+	if one := SummarizeReplicates(runs[:1]); one[0].SD != 0 || one[0].CILow != 1 || one[0].CIHigh != 1 {
+		t.Fatalf("single run summarized as %+v", one[0])
+	}
+	if SummarizeReplicates(nil) != nil {
+		t.Fatalf("no runs summarized")
+	}
+}
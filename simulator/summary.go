@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Metric is a single number summarizing a run.
+type Metric struct {
+	Name  string
+	Value float64
+}
+
+// Percentile returns the p-th percentile (0 to 1) of sorted values
+// using the nearest rank. Returns 0 if there are no values.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// LatencyDist counts delivered packets by latency. Latencies take few
+// distinct values, so it stays small however many packets are counted.
+type LatencyDist map[time.Duration]int
+
+func (d LatencyDist) Merge(other LatencyDist) {
+	for l, n := range other {
+		d[l] += n
+	}
+}
+
+func (d LatencyDist) Count() int {
+	count := 0
+	for _, n := range d {
+		count += n
+	}
+	return count
+}
+
+// Values returns the distinct latencies, in milliseconds and in increasing
+// order, with the number of packets delivered after each.
+func (d LatencyDist) Values() ([]float64, []int) {
+	latencies := make([]time.Duration, 0, len(d))
+	for l := range d {
+		latencies = append(latencies, l)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	values := make([]float64, len(latencies))
+	counts := make([]int, len(latencies))
+	for i, l := range latencies {
+		values[i] = float64(l) / float64(time.Millisecond)
+		counts[i] = d[l]
+	}
+	return values, counts
+}
+
+// Mean latency in milliseconds
+func (d LatencyDist) Mean() float64 {
+	values, counts := d.Values()
+	sum, count := 0.0, 0
+	for i, l := range values {
+		sum += l * float64(counts[i])
+		count += counts[i]
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// Percentile returns the p-th percentile (0 to 1) of the latencies in
+// milliseconds, using the nearest rank as Percentile does.
+func (d LatencyDist) Percentile(p float64) float64 {
+	values, counts := d.Values()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p*float64(total))) - 1
+	for i, n := range counts {
+		if rank < n {
+			return values[i]
+		}
+		rank -= n
+	}
+	return values[len(values)-1]
+}
+
+// LatenciesByDst returns the latencies of the packets delivered to each chain.
+func (s *State) LatenciesByDst() map[string]LatencyDist {
+	by_dst := make(map[string]LatencyDist)
+	if s.Finished != nil {
+		for dst, d := range s.Finished.Latencies {
+			by_dst[dst] = make(LatencyDist, len(d))
+			by_dst[dst].Merge(d)
+		}
+	}
+	for _, p := range s.Packets {
+		if !p.Delivered {
+			continue
+		}
+		if _, ok := by_dst[p.Dst]; !ok {
+			by_dst[p.Dst] = make(LatencyDist)
+		}
+		by_dst[p.Dst][p.Latency()]++
+	}
+	return by_dst
+}
+
+// Latencies returns the latencies of every delivered packet.
+func (s *State) Latencies() LatencyDist {
+	all := make(LatencyDist)
+	for _, d := range s.LatenciesByDst() {
+		all.Merge(d)
+	}
+	return all
+}
+
+// Summarize returns the summary metrics of a run, always in the same order.
+// Blocks with more transactions than the threshold count as overloaded.
+func Summarize(s *State, threshold int) []Metric {
+	packets := s.CountPackets()
+
+	total_tx, total_msgs, max_congestion, wasted, redundant := 0, 0, 0, 0, 0
+	total_gas := uint64(0)
+	total_fees := 0.0
+	blocks, overloaded := 0, 0
+	totals := make([]float64, 0, len(s.Chains))
+	for _, id := range s.ChainIDs() {
+		chain, ok := s.Chains[id]
+		if !ok {
+			continue
+		}
+
+		total_tx += chain.TotalTx()
+		total_msgs += chain.TotalMsgs()
+		wasted += chain.WastedTx()
+		redundant += chain.RedundantUpdates()
+		total_gas += chain.GasUsed()
+		total_fees += chain.Fees()
+		if chain.GetMaxTxCount() > max_congestion {
+			max_congestion = chain.GetMaxTxCount()
+		}
+
+		for load, n := range chain.BlockLoads() {
+			blocks += n
+			if load > threshold {
+				overloaded += n
+			}
+		}
+		totals = append(totals, float64(chain.TotalTx()))
+	}
+
+	overloaded_share := 0.0
+	if blocks > 0 {
+		overloaded_share = float64(overloaded) / float64(blocks)
+	}
+
+	latencies := s.Latencies()
+
+	metrics := []Metric{
+		{"packets", float64(packets.Sent)},
+		{"delivered", float64(packets.Delivered)},
+		{"lost", float64(packets.Lost)},
+		{"timed_out", float64(packets.TimedOut)},
+		{"unroutable", float64(s.Topology.Unroutable)},
+		{"total_tx", float64(total_tx)},
+		{"total_msgs", float64(total_msgs)},
+		{"max_congestion", float64(max_congestion)},
+		{"overloaded_blocks", overloaded_share},
+		{"load_gini", Gini(totals)},
+		{"wasted_tx", float64(wasted)},
+		{"redundant_updates", float64(redundant)},
+		{"latency_mean_ms", latencies.Mean()},
+		{"latency_p50_ms", latencies.Percentile(0.5)},
+		{"latency_p90_ms", latencies.Percentile(0.9)},
+		{"latency_p99_ms", latencies.Percentile(0.99)},
+		{"total_gas", float64(total_gas)},
+		{"total_fees", total_fees},
+	}
+	for _, name := range customMetrics {
+		metrics = append(metrics, Metric{name, s.metrics[name]})
+	}
+	return metrics
+}
@@ -0,0 +1,286 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	TOPOLOGY_OPEN   = 0 // open a connection between two chains
+	TOPOLOGY_CLOSE  = 1 // close the connection between two chains
+	TOPOLOGY_ADD    = 2 // add a chain to the network
+	TOPOLOGY_REMOVE = 3 // remove a chain and all of its connections
+)
+
+// TopologyChange describes a change to the network at a given time.
+type TopologyChange struct {
+	Kind  uint32
+	Chain string
+	Peer  string // counterparty chain for connection changes
+	Time  time.Time
+}
+
+func (tc *TopologyChange) String() string {
+	switch tc.Kind {
+	case TOPOLOGY_OPEN:
+		return fmt.Sprintf("open %s-%s", tc.Chain, tc.Peer)
+	case TOPOLOGY_CLOSE:
+		return fmt.Sprintf("close %s-%s", tc.Chain, tc.Peer)
+	case TOPOLOGY_ADD:
+		return fmt.Sprintf("add %s", tc.Chain)
+	case TOPOLOGY_REMOVE:
+		return fmt.Sprintf("remove %s", tc.Chain)
+	}
+	return "unknown topology change"
+}
+
+// TopologyStats counts the topology changes made during a run and the
+// packets that were affected by them.
+type TopologyStats struct {
+	Changes    int
+	Rerouted   int // packets sent over a different route than the pair's packet before a change
+	Unroutable int // sends dropped because no route existed when sending
+	Lost       int // packets in flight whose route was cut
+}
+
+type route struct {
+	hops    []string
+	err     error
+	changed bool // the route differs from the one used before a topology change, until a packet is sent over it
+}
+
+// ReserveChain registers a chain that will join the network during the run,
+// so that implicit events can be scheduled for it. This must be called
+// before the implicit events are initialized.
+func (s *State) ReserveChain(chain_id string) {
+	if _, ok := s.Chains[chain_id]; ok {
+		return
+	}
+	s.reserved[chain_id] = true
+}
+
+func (s *State) IsReserved(chain_id string) bool {
+	return s.reserved[chain_id]
+}
+
+// ChainIDs returns the sorted IDs of all chains, including those that have been reserved.
+// Iterating in this order keeps runs reproducible from a seed.
+func (s *State) ChainIDs() []string {
+	ids := make([]string, 0, len(s.Chains)+len(s.reserved))
+	for id := range s.Chains {
+		ids = append(ids, id)
+	}
+	for id := range s.reserved {
+		if _, ok := s.Chains[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// RemoveChain removes the chain along with its connections to every neighbour.
+func (s *State) RemoveChain(chain_id string) {
+	ch, ok := s.Chains[chain_id]
+	if !ok {
+		return
+	}
+
+	for _, n := range ch.GetNeighbours() {
+		n.RemoveNeighbour(chain_id)
+	}
+	delete(s.Chains, chain_id)
+}
+
+// OpenConnection connects two chains that are both part of the network.
+func (s *State) OpenConnection(a, b string) error {
+	ca, ok := s.Chains[a]
+	if !ok {
+		return fmt.Errorf("cannot find chain %s to open connection", a)
+	}
+	cb, ok := s.Chains[b]
+	if !ok {
+		return fmt.Errorf("cannot find chain %s to open connection", b)
+	}
+
+	ca.AddNeighbour(cb)
+	cb.AddNeighbour(ca)
+	return nil
+}
+
+func (s *State) CloseConnection(a, b string) error {
+	ca, ok := s.Chains[a]
+	if !ok {
+		return fmt.Errorf("cannot find chain %s to close connection", a)
+	}
+	cb, ok := s.Chains[b]
+	if !ok {
+		return fmt.Errorf("cannot find chain %s to close connection", b)
+	}
+
+	ca.RemoveNeighbour(b)
+	cb.RemoveNeighbour(a)
+	return nil
+}
+
+// GetRoute returns the route used to send packets from src to dst, including
+// the source chain. Routes are cached until the topology changes.
+// The route is always constrained to hub chains when checking reachability.
+// If not direct, the unconstrained Baton shortest path is used for sending.
+func (s *State) GetRoute(ctx context.Context, src, dst string) ([]string, error) {
+	key := fmt.Sprintf("%s-%s", src, dst)
+	if r, ok := s.routes[key]; ok {
+		return r.hops, r.err
+	}
+
+	direct := ctx.Value(GetContextKey(DirectContextKey)).(bool)
+	hub_chains := ctx.Value(GetContextKey(HubsContextKey)).(map[string]bool)
+
+	sp, err := GetShortestPath(ctx, src, dst, hub_chains)
+	if err == nil && !direct {
+		// We are using baton. Therefore, get the Baton shortest path
+		sp, err = GetShortestPath(ctx, src, dst, make(map[string]bool))
+	}
+
+	if err != nil {
+		s.unreachable[Pair{Src: src, Dst: dst}] = true
+	}
+
+	r := &route{hops: sp, err: err}
+	if old, ok := s.stale_routes[key]; ok {
+		r.changed = old.changed || !equalRoutes(old.hops, r.hops)
+	}
+	s.routes[key] = r
+
+	return sp, err
+}
+
+// useRoute returns the route for a packet being sent, recording how
+// the packet is affected by earlier topology changes.
+func (s *State) useRoute(ctx context.Context, src, dst string) ([]string, error) {
+	sp, err := s.GetRoute(ctx, src, dst)
+	if err != nil {
+		s.Topology.Unroutable++
+		return nil, err
+	}
+
+	// Only the first packet sent over the new route is rerouted. Later
+	// packets follow the route the pair already uses.
+	if r := s.routes[fmt.Sprintf("%s-%s", src, dst)]; r.changed {
+		s.Topology.Rerouted++
+		r.changed = false
+	}
+	s.recordRouteUse(src, dst, sp)
+	return sp, nil
+}
+
+// InvalidateRoutes clears the route cache. Previously used routes are kept
+// to detect which pairs get rerouted.
+func (s *State) InvalidateRoutes() {
+	for key, r := range s.routes {
+		s.stale_routes[key] = r
+	}
+	s.routes = make(map[string]*route)
+}
+
+// MarkLost records that the packet can no longer reach its destination.
+func (s *State) MarkLost(id uint64) {
+	p, ok := s.Packets[id]
+	if !ok || p.Lost || p.Delivered {
+		return
+	}
+	p.Lost = true
+	s.Topology.Lost++
+	s.finishPacket(p)
+}
+
+func equalRoutes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Topology event. Applies a change to the network.
+type TopologyEvent struct {
+	event_time time.Time
+	change     *TopologyChange
+}
+
+func NewTopologyEvent(change *TopologyChange) *TopologyEvent {
+	return &TopologyEvent{event_time: change.Time, change: change}
+}
+
+// Change returns the change that the event applies.
+func (e *TopologyEvent) Change() *TopologyChange {
+	return e.change
+}
+
+func (e *TopologyEvent) Execute(ctx context.Context) {
+	state, err := GetStateFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	switch e.change.Kind {
+	case TOPOLOGY_OPEN:
+		err = state.OpenConnection(e.change.Chain, e.change.Peer)
+	case TOPOLOGY_CLOSE:
+		err = state.CloseConnection(e.change.Chain, e.change.Peer)
+	case TOPOLOGY_ADD:
+		if _, ok := state.Chains[e.change.Chain]; !ok {
+			ch := NewChain(e.change.Chain)
+			ch.SetLastBlockTime(e.Time())
+			state.AddChain(ch)
+		}
+	case TOPOLOGY_REMOVE:
+		state.RemoveChain(e.change.Chain)
+	}
+
+	if err != nil {
+		state.Logf("could not change topology. %s\n", err.Error())
+		return
+	}
+
+	state.Topology.Changes++
+	state.InvalidateRoutes()
+	state.Logf("Topology changed: %s: %v\n", e.change, e.Time())
+}
+
+func (e *TopologyEvent) Type() uint64 {
+	return TOPOLOGY_EVENT_TYPE
+}
+
+func (e *TopologyEvent) Copy() Event {
+	return &TopologyEvent{event_time: e.Time(), change: e.change}
+}
+
+func (e *TopologyEvent) Time() time.Time {
+	return e.event_time
+}
+
+func (e *TopologyEvent) AddMsg() {
+	fmt.Printf("Adding topology event with time: %v\n", e.Time())
+}
+
+func (e *TopologyEvent) SubEvents() []Event {
+	return nil
+}
+
+func (e *TopologyEvent) Following() []Event {
+	return nil
+}
+
+func (e *TopologyEvent) SetFollowing(events []Event) {
+}
+
+func (e *TopologyEvent) AdjustTime(t time.Time) {
+	e.event_time = t
+}
@@ -0,0 +1,62 @@
+package simulator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Packets are rerouted once after the topology changes, and sends without a
+// route are dropped
+func TestTopologyChanges(t *testing.T) {
+	q, ctx := newTestQueue(0)
+	state := q.BatonState
+	change := func(kind uint32, chain, peer string) {
+		NewTopologyEvent(&TopologyChange{Kind: kind, Chain: chain, Peer: peer, Time: state.Start}).Execute(ctx)
+	}
+	send := func(src, dst string, want []string) {
+		t.Helper()
+		route, err := state.useRoute(ctx, src, dst)
+		if want == nil && err == nil {
+			t.Fatalf("%s to %s was routed over %v", src, dst, route)
+		}
+		if want != nil && !reflect.DeepEqual(route, want) {
+			t.Fatalf("%s to %s was routed over %v, want %v", src, dst, route, want)
+		}
+	}
+
+	send("a", "d", []string{"a", "b", "c", "d"})
+	change(TOPOLOGY_ADD, "e", "")
+	change(TOPOLOGY_OPEN, "a", "e")
+	change(TOPOLOGY_OPEN, "e", "d")
+	send("a", "d", []string{"a", "e", "d"})
+	send("a", "d", []string{"a", "e", "d"})
+	if state.Topology.Rerouted != 1 {
+		t.Fatalf("%d packets rerouted, want 1", state.Topology.Rerouted)
+	}
+
+	change(TOPOLOGY_REMOVE, "e", "")
+	change(TOPOLOGY_CLOSE, "c", "d")
+	send("a", "d", nil)
+	send("a", "c", []string{"a", "b", "c"})
+	if state.Topology.Changes != 5 || state.Topology.Unroutable != 1 {
+		t.Fatalf("topology stats are %+v", state.Topology)
+	}
+}
+
+// Packets in flight over a connection that is closed are lost
+func TestTopologyCut(t *testing.T) {
+	q, ctx := newTestQueue(20)
+	state := q.BatonState
+	runUntil(q, ctx, state.Start.Add(5*time.Second))
+	q.Enqueue(NewTopologyEvent(&TopologyChange{Kind: TOPOLOGY_CLOSE, Chain: "b", Peer: "c", Time: state.Start.Add(5 * time.Second)}))
+	finish(q, ctx)
+
+	packets := state.CountPackets()
+	if state.Topology.Lost == 0 || packets.Lost != state.Topology.Lost {
+		t.Fatalf("%d packets lost, %d by the topology", packets.Lost, state.Topology.Lost)
+	}
+	if state.Topology.Unroutable == 0 {
+		t.Fatalf("sends after the cut were routed")
+	}
+}